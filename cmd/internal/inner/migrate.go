@@ -0,0 +1,39 @@
+package inner
+
+import (
+	"github.com/ckeyer/tarofs/pkgs/fs"
+	"github.com/ckeyer/tarofs/pkgs/storage/levelfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmds = append(cmds, migrateCommand())
+}
+
+func migrateCommand() *cobra.Command {
+	var leveldir string
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "rewrite the JSON metadata of an unmounted volume in the binary format",
+		Run: func(cmd *cobra.Command, args []string) {
+			stgr, err := levelfs.NewLevelStorage(leveldir)
+			if err != nil {
+				logrus.Fatalf("open leveldb %s failed, %s", leveldir, err)
+			}
+			defer stgr.Close()
+
+			n, err := fs.MigrateFormat(stgr)
+			if err != nil {
+				logrus.Fatalf("migrate failed after %v values, %s", n, err)
+			}
+			logrus.Infof("migrate successful, rewrote %v values.", n)
+		},
+		// migrate exits when it is done.
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.Flags().StringVarP(&leveldir, "leveldb-dir", "l", "/data/tarofs_data", "leveldb data directory.")
+	return cmd
+}
@@ -1,6 +1,16 @@
 package inner
 
-import "github.com/spf13/cobra"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ckeyer/tarofs/pkgs/fs"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/ckeyer/tarofs/pkgs/storage/levelfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
 
 func init() {
 	cmds = append(cmds, nodeCommand())
@@ -11,8 +21,10 @@ func nodeCommand() *cobra.Command {
 		Use:   "node",
 		Short: "inode database",
 		Run: func(cmd *cobra.Command, args []string) {
-
+			cmd.Help()
 		},
+		// the inode database commands exit when they are done.
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {},
 	}
 
 	cmd.AddCommand(getNodeCommand())
@@ -21,13 +33,71 @@ func nodeCommand() *cobra.Command {
 }
 
 func getNodeCommand() *cobra.Command {
+	var (
+		leveldir string
+		start    string
+		limit    string
+		reverse  bool
+	)
+
 	cmd := &cobra.Command{
-		Use:   "get",
+		Use:   "get [inode...]",
 		Short: "get or list inode infomation",
 		Run: func(cmd *cobra.Command, args []string) {
+			stgr, err := levelfs.NewLevelStorage(leveldir)
+			if err != nil {
+				logrus.Fatalf("open leveldb %s failed, %s", leveldir, err)
+			}
+			defer stgr.Close()
+
+			snap, err := stgr.NewSnapshot()
+			if err != nil {
+				logrus.Fatalf("snapshot failed, %s", err)
+			}
+			defer snap.Release()
+
+			enc := json.NewEncoder(os.Stdout)
+			if len(args) > 0 {
+				for _, inode := range args {
+					attr, err := fs.DecodeMetadata(func(v interface{}) error {
+						return snap.Get(fs.PrefixMetadata+inode, v)
+					})
+					if err != nil {
+						logrus.Fatalf("get inode %s failed, %s", inode, err)
+					}
+					enc.Encode(attr)
+				}
+				return
+			}
 
+			r := storage.Range{Prefix: fs.PrefixMetadata, Reverse: reverse}
+			if start != "" {
+				r.Start = fs.PrefixMetadata + start
+			}
+			if limit != "" {
+				r.Limit = fs.PrefixMetadata + limit
+			}
+			it := snap.NewRangeIterator(r)
+			defer it.Release()
+			n := 0
+			for it.Next() {
+				attr, err := fs.DecodeMetadata(it.Value)
+				if err != nil {
+					logrus.Fatalf("decode %s failed, %s", it.Key(), err)
+				}
+				enc.Encode(attr)
+				n++
+			}
+			if err := it.Error(); err != nil {
+				logrus.Fatalf("list inodes failed, %s", err)
+			}
+			fmt.Fprintf(os.Stderr, "%d inodes\n", n)
 		},
 	}
 
+	cmd.Flags().StringVarP(&leveldir, "leveldb-dir", "l", "/data/tarofs_data", "leveldb data directory.")
+	cmd.Flags().StringVar(&start, "start", "", "list the inodes whose key is not less than start.")
+	cmd.Flags().StringVar(&limit, "limit", "", "list the inodes whose key is less than limit.")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "list in descending key order.")
 	return cmd
 }
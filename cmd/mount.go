@@ -16,8 +16,16 @@ func init() {
 
 func MoundCmd() *cobra.Command {
 	var (
-		mountDir string
-		leveldir string
+		mountDir  string
+		leveldir  string
+		chunkSize uint64
+		capacity  uint64
+		maxInodes uint64
+		syncMode  string
+		atime     string
+
+		defaultPermissions bool
+		devices            bool
 	)
 
 	cmd := &cobra.Command{
@@ -34,12 +42,38 @@ func MoundCmd() *cobra.Command {
 			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			stgr, err := levelfs.NewLevelStorage(leveldir)
+			mode, err := fs.ParseSyncMode(syncMode)
+			if err != nil {
+				logrus.Fatalf("parse sync mode failed, %s", err)
+			}
+			atimePolicy, err := fs.ParseAtimePolicy(atime)
+			if err != nil {
+				logrus.Fatalf("parse atime policy failed, %s", err)
+			}
+
+			var levelOpts []levelfs.Option
+			if mode == fs.SyncAlways {
+				levelOpts = append(levelOpts, levelfs.WithSyncWrites())
+			}
+			stgr, err := levelfs.NewLevelStorage(leveldir, levelOpts...)
 			if err != nil {
 				logrus.Fatalf("new levelfs storage failed, %s", err)
 				return
 			}
-			filesys, err := fs.NewFS(mountDir, stgr, stgr)
+			opts := []fs.Option{
+				fs.WithChunkSize(chunkSize),
+				fs.WithCapacity(capacity),
+				fs.WithMaxInodes(maxInodes),
+				fs.WithSyncMode(mode),
+				fs.WithAtime(atimePolicy),
+			}
+			if defaultPermissions {
+				opts = append(opts, fs.WithDefaultPermissions())
+			}
+			if devices {
+				opts = append(opts, fs.WithDevices())
+			}
+			filesys, err := fs.NewFS(mountDir, stgr, stgr, opts...)
 			if err != nil {
 				logrus.Fatal("new mount falied, ", err)
 			}
@@ -68,6 +102,13 @@ func MoundCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&mountDir, "mount-point", "m", "/tmp/tarofs", "mount point directory.")
 	cmd.Flags().StringVarP(&leveldir, "leveldb-dir", "l", "/data/tarofs_data", "leveldb data directory.")
+	cmd.Flags().Uint64Var(&chunkSize, "chunk-size", 0, "chunk size of file data when formatting a new volume, 0 for the default.")
+	cmd.Flags().Uint64Var(&capacity, "capacity", 0, "capacity of file data in bytes, 0 for no limit.")
+	cmd.Flags().Uint64Var(&maxInodes, "max-inodes", 0, "maximum number of inodes, 0 for no limit.")
+	cmd.Flags().StringVar(&syncMode, "sync-mode", string(fs.SyncOnFsync), "when writes are made durable, always, on-fsync or never.")
+	cmd.Flags().StringVar(&atime, "atime", string(fs.AtimeRelative), "when reads update the access time, noatime, relatime or strictatime.")
+	cmd.Flags().BoolVar(&defaultPermissions, "default-permissions", false, "let the kernel check permissions instead of tarofs.")
+	cmd.Flags().BoolVar(&devices, "allow-dev", false, "allow creating and opening character and block devices.")
 	return cmd
 }
 
@@ -2,11 +2,13 @@ package fs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"bazil.org/fuse"
@@ -16,25 +18,160 @@ import (
 )
 
 const (
-	PrefixINode    = "tarofs_inode_"
+	PrefixDirent   = "tarofs_dirent_"
 	PrefixMetadata = "tarofs_metadata_"
-	PrefixPath     = "tarofs_path_"
 	PrefixData     = "tarofs_data_"
+
+	// PrefixINode and PrefixPath keyed inodes and child lists by full path
+	// before the namespace was keyed by inode, they are only read to
+	// migrate old volumes.
+	PrefixINode = "tarofs_inode_"
+	PrefixPath  = "tarofs_path_"
 )
 
 type FS struct {
 	metadataStorager storage.MetadataStorager
 	dataStorager     storage.DataStorager
-
-	mountDir string
+	// sharedData is set when the data lives in the metadata store, a txn
+	// then commits its chunk changes in its batch.
+	sharedData bool
+
+	mountDir  string
+	cfg       config
+	sb        *superblock
+	chunkSize uint64
+	inodes    *inodeAllocator
+	opens     openCounter
+	locks     inodeLocks
+	fileLocks lockTable
+	usage     *usageCounter
 
 	conn *fuse.Conn
 	srv  *fs.Server
 }
 
+type config struct {
+	chunkSize uint64
+	capacity  uint64
+	maxInodes uint64
+	syncMode  SyncMode
+	atime     AtimePolicy
+
+	defaultPermissions bool
+	devices            bool
+}
+
+// Option configures the FS.
+type Option func(*config)
+
+// WithChunkSize sets the chunk size of file data, it only takes effect
+// when a new volume is formatted.
+func WithChunkSize(n uint64) Option {
+	return func(c *config) {
+		c.chunkSize = n
+	}
+}
+
+// WithCapacity limits the bytes of file data, 0 means no limit.
+func WithCapacity(n uint64) Option {
+	return func(c *config) {
+		c.capacity = n
+	}
+}
+
+// WithMaxInodes limits the number of inodes, 0 means no limit.
+func WithMaxInodes(n uint64) Option {
+	return func(c *config) {
+		c.maxInodes = n
+	}
+}
+
+// WithSyncMode sets when writes are made durable, SyncOnFsync by default.
+func WithSyncMode(mode SyncMode) Option {
+	return func(c *config) {
+		c.syncMode = mode
+	}
+}
+
+// WithAtime sets when reads update the access time, AtimeRelative by
+// default.
+func WithAtime(policy AtimePolicy) Option {
+	return func(c *config) {
+		c.atime = policy
+	}
+}
+
+// WithDefaultPermissions leaves the permission checks to the kernel, which
+// checks the attributes tarofs reports.
+func WithDefaultPermissions() Option {
+	return func(c *config) {
+		c.defaultPermissions = true
+	}
+}
+
+// WithDevices allows Mknod to create character and block devices and lets
+// the kernel open them.
+func WithDevices() Option {
+	return func(c *config) {
+		c.devices = true
+	}
+}
+
 // NewFS .
-func NewFS(mountDir string, ms storage.MetadataStorager, ds storage.DataStorager) (*FS, error) {
-	conn, err := Mount(mountDir)
+func NewFS(mountDir string, ms storage.MetadataStorager, ds storage.DataStorager, opts ...Option) (*FS, error) {
+	f := &FS{
+		metadataStorager: ms,
+		dataStorager:     ds,
+		mountDir:         mountDir,
+		opens:            openCounter{count: map[uint64]int{}},
+		locks:            inodeLocks{locks: map[uint64]*inodeLock{}},
+		fileLocks:        lockTable{files: map[uint64]*fileLocks{}},
+		cfg:              config{syncMode: SyncOnFsync, atime: AtimeRelative},
+	}
+	for _, opt := range opts {
+		opt(&f.cfg)
+	}
+	if typ := reflect.TypeOf(ms); typ != nil && typ == reflect.TypeOf(ds) && typ.Comparable() {
+		f.sharedData = interface{}(ms) == interface{}(ds)
+	}
+
+	if err := f.loadSuperblock(); err != nil {
+		return nil, fmt.Errorf("load superblock failed, %v", err)
+	}
+	if err := f.migrateLegacyNamespace(); err != nil {
+		return nil, fmt.Errorf("migrate namespace failed, %v", err)
+	}
+	inodes, err := newInodeAllocator(ms)
+	if err != nil {
+		return nil, fmt.Errorf("load inode allocator failed, %v", err)
+	}
+	f.inodes = inodes
+	usage, err := newUsageCounter(ms)
+	if err != nil {
+		return nil, fmt.Errorf("load usage failed, %v", err)
+	}
+	f.usage = usage
+	if err := f.createRoot(); err != nil {
+		return nil, fmt.Errorf("create root failed, %v", err)
+	}
+	if err := f.recordParents(); err != nil {
+		return nil, fmt.Errorf("record parents failed, %v", err)
+	}
+	if err := f.sweepOrphans(); err != nil {
+		return nil, fmt.Errorf("sweep orphans failed, %v", err)
+	}
+
+	var mountOpts []fuse.MountOption
+	if f.writebackCache() {
+		mountOpts = append(mountOpts, fuse.WritebackCache())
+	}
+	if f.cfg.defaultPermissions {
+		mountOpts = append(mountOpts, fuse.DefaultPermissions())
+	}
+	if f.cfg.devices {
+		mountOpts = append(mountOpts, fuse.AllowDev())
+	}
+	conn, err := Mount(mountDir, mountOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("mount falied, %v", err)
 	}
@@ -44,20 +181,17 @@ func NewFS(mountDir string, ms storage.MetadataStorager, ds storage.DataStorager
 		return nil, fmt.Errorf("kernel FUSE support is too old to have invalidations: version %v", p)
 	}
 
-	return &FS{
-		metadataStorager: ms,
-		dataStorager:     ds,
-		mountDir:         mountDir,
-
-		conn: conn,
-		srv:  fs.New(conn, nil),
-	}, nil
+	f.conn = conn
+	f.srv = fs.New(conn, nil)
+	return f, nil
 }
 
 // Serve .
 func (f *FS) Serve() error {
 	logrus.Debug("start levelfs server.")
-	return f.srv.Serve(f)
+	if err := f.srv.Serve(f); err != nil {
+		return err
+	}
 
 	// Check if the mount process has an error to report.
 	<-f.conn.Ready
@@ -77,43 +211,83 @@ var _ fs.FSInodeGenerator = (*FS)(nil)
 
 // Root .
 func (f *FS) Root() (fs.Node, error) {
-	return &Dir{FS: f, path: "/", inode: 1}, nil
+	return &Dir{FS: f, name: "/", inode: 1}, nil
 }
 
-// GenerateInode .
+// GenerateInode allocates a new inode, it falls back to a dynamic inode
+// when the allocator state can not be persisted.
 func (f *FS) GenerateInode(parentInode uint64, name string) uint64 {
-	return uint64(time.Now().UnixNano())
+	inode, err := f.inodes.allocate()
+	if err != nil {
+		logrus.Errorf("allocate inode failed, %s", err)
+		return fs.GenerateDynamicInode(parentInode, name)
+	}
+	return inode
 }
 
+// setattr applies the fields of req selected by req.Valid, a size change
+// shrinks or zero extends the data of a regular file.
+//
+// TODO: fallocate(2) preallocation and hole punching, bazil.org/fuse does
+// not decode FUSE_FALLOCATE yet.
 func (f *FS) setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse, inode uint64) error {
+	defer f.locks.lock(inode)()
 	attr, err := f.getMetadata(inode)
 	if err != nil {
 		logrus.Errorf("get %v attr failed, %s", inode, err)
 		return err
 	}
+	if err := f.checkSetattr(req, attr); err != nil {
+		return err
+	}
 
-	attr.Mode = req.Mode
-	attr.Size = req.Size
-	attr.Mtime = time.Now()
-	attr.Uid = req.Uid
-	attr.Gid = req.Gid
+	t := f.begin()
+	now := time.Now()
+	if req.Valid.Size() {
+		if !attr.Mode.IsRegular() {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		if err := t.resize(attr, req.Size); err != nil {
+			logrus.Errorf("truncate %v failed, %s", inode, err)
+			return err
+		}
+	}
+	if req.Valid.Mode() {
+		// the kernel does not always send the file type, keep ours.
+		attr.Mode = attr.Mode&os.ModeType | req.Mode&^os.ModeType
+	}
+	if req.Valid.Uid() {
+		attr.Uid = req.Uid
+	}
+	if req.Valid.Gid() {
+		attr.Gid = req.Gid
+	}
+	// utimensat(2) with UTIME_NOW sends no time, UTIME_OMIT sends nothing.
+	if req.Valid.AtimeNow() {
+		attr.Atime = now
+	} else if req.Valid.Atime() {
+		attr.Atime = req.Atime
+	}
+	if req.Valid.MtimeNow() {
+		attr.Mtime = now
+	} else if req.Valid.Mtime() {
+		attr.Mtime = req.Mtime
+	}
+	attr.Ctime = now
 
-	if err := f.putMetadata(attr); err != nil {
+	if err := t.putMetadata(attr); err != nil {
+		return err
+	}
+	if err := t.commit(); err != nil {
 		logrus.Errorf("set attr failed, %s", err)
 		return err
 	}
 
-	resp.Attr = *attr
+	resp.Attr = attr.Attr
 	return nil
 }
 
 func (f *FS) attr(ctx context.Context, a *fuse.Attr, inode uint64) error {
-	if inode == 1 {
-		a.Inode = 1
-		a.Mode = os.ModeDir | a.Mode
-		return nil
-	}
-
 	a.Inode = inode
 	att, err := f.getMetadata(inode)
 	if err != nil {
@@ -124,7 +298,7 @@ func (f *FS) attr(ctx context.Context, a *fuse.Attr, inode uint64) error {
 	a.Size = att.Size
 	a.Blocks = att.Blocks
 	a.Atime = att.Atime
-	a.Mtime = time.Now()
+	a.Mtime = att.Mtime
 	a.Ctime = att.Ctime
 	a.Crtime = att.Crtime
 	a.Mode = att.Mode
@@ -138,143 +312,117 @@ func (f *FS) attr(ctx context.Context, a *fuse.Attr, inode uint64) error {
 	return nil
 }
 
-// remove
-func (f *FS) remove(ctx context.Context, req *fuse.RemoveRequest, parent string) error {
+// remove unlinks the entry req.Name of the directory parent. Rmdir only
+// removes empty directories and unlink refuses directories, the data of a
+// file is released with its last link.
+func (f *FS) remove(ctx context.Context, req *fuse.RemoveRequest, parent uint64) error {
 	logrus.Debugf("remove file: %+v", req)
-	req.Name = filepath.Clean(req.Name)
-	children, err := f.getChildren(parent)
+	_, unlock, err := f.lockEntries([]uint64{parent}, entryRef{parent, req.Name})
 	if err != nil {
-		logrus.Errorf("remove file, list children faield, %s", children)
-		return fuse.ENOENT
-	}
-
-	exists := false
-	for i, child := range children {
-		if child == req.Name {
-			exists = true
-			children = append(children[:i], children[i+1:]...)
-			break
-		}
-	}
-	if !exists {
-		return fuse.ENOENT
+		return err
 	}
-
-	if err := f.putChildNode(parent, children); err != nil {
-		logrus.Errorf("remove file, reset dir path failed, %s", err)
-		return fuse.ENOENT
+	defer unlock()
+	now := time.Now()
+	dattr, err := f.checkDirWrite(&req.Header, parent)
+	if err != nil {
+		return err
 	}
-
-	fullname := filepath.Join(parent, req.Name)
-	inode, err := f.getPath(fullname)
+	t := f.begin()
+	de, err := t.getDirent(parent, req.Name)
 	if err != nil {
-		logrus.Errorf("remove file, get inode %s faield, %s", fullname, children)
-		return fuse.ENOENT
+		return err
 	}
-
-	f.deletePath(fullname)
-	f.deleteMetadata(inode)
-
-	return nil
-}
-
-func (f *FS) getPath(path string) (uint64, error) {
-	key := PrefixINode + path
-	var inode uint64
-	err := f.metadataStorager.Get(key, &inode)
+	attr, err := t.getMetadata(de.Inode)
 	if err != nil {
-		return 0, err
+		logrus.Errorf("remove file, get metadata %v failed, %s", de.Inode, err)
+		return err
 	}
-	return inode, nil
-}
-
-func (f *FS) putPath(path string, inode uint64) error {
-	key := PrefixINode + path
-	err := f.metadataStorager.Get(key, nil)
-	if err == nil {
-		return fuse.EEXIST
-	} else if err != storage.ErrNotFound {
+	if err := f.checkSticky(&req.Header, dattr, attr); err != nil {
 		return err
 	}
 
-	return f.metadataStorager.Put(key, inode)
-}
-
-// deletePath
-func (f *FS) deletePath(path string) error {
-	key := PrefixINode + path
-	return f.metadataStorager.Delete(key)
-}
+	switch {
+	case req.Dir && !attr.Mode.IsDir():
+		return fuse.Errno(syscall.ENOTDIR)
+	case !req.Dir && attr.Mode.IsDir():
+		return fuse.Errno(syscall.EISDIR)
+	case attr.Mode.IsDir():
+		notEmpty, err := t.hasDirents(attr.Inode)
+		if err != nil {
+			return err
+		}
+		if notEmpty {
+			return fuse.Errno(syscall.ENOTEMPTY)
+		}
+	}
 
-// addChildNode
-func (f *FS) addChildNode(parent, name string) error {
-	oldChildren, err := f.getChildren(parent)
+	t.deleteDirent(parent, req.Name)
+	if err := t.touchDir(parent, now); err != nil {
+		return err
+	}
+	if attr.Mode.IsDir() {
+		if err := t.freeInode(attr); err != nil {
+			return err
+		}
+		err = t.adjustNlink(parent, -1)
+	} else {
+		err = t.unlink(attr)
+	}
 	if err != nil {
 		return err
 	}
 
-	return f.putChildNode(parent, append(oldChildren, name))
+	if err := t.commit(); err != nil {
+		logrus.Errorf("remove file %s failed, %s", req.Name, err)
+		return err
+	}
+	return nil
 }
 
-func (f *FS) putChildNode(parent string, children []string) error {
-	key := PrefixPath + parent
-	return f.metadataStorager.Put(key, children)
-}
+// metadata is the stored metadata of an inode.
+type metadata struct {
+	fuse.Attr
 
-// getChildren
-func (f *FS) getChildren(parent string) ([]string, error) {
-	key := PrefixPath + parent
-	children := []string{}
+	// Target is the target of a symbolic link.
+	Target string `json:"target,omitempty"`
+}
 
-	if err := f.metadataStorager.Get(key, &children); err != nil {
-		if err == storage.ErrNotFound {
-			return []string{}, nil
-		}
+// DecodeMetadata decodes stored inode metadata with decode, the Get of a
+// key or the Value of an iterator, and returns it as JSON for the
+// maintenance commands.
+func DecodeMetadata(decode func(v interface{}) error) (json.RawMessage, error) {
+	attr := &metadata{}
+	if err := decode(attr); err != nil {
 		return nil, err
 	}
+	return json.Marshal(attr)
+}
 
-	return children, nil
+func metadataKey(inode uint64) string {
+	return PrefixMetadata + fmt.Sprint(inode)
 }
 
 // putMetadata
-func (f *FS) putMetadata(attr *fuse.Attr) error {
+func (f *FS) putMetadata(attr *metadata) error {
 	if attr.Inode == 0 {
 		return fmt.Errorf("to set zero inode")
 	}
-	key := PrefixMetadata + fmt.Sprint(attr.Inode)
-	return f.metadataStorager.Put(key, attr)
+	return f.metadataStorager.Put(metadataKey(attr.Inode), attr)
 }
 
 // getMetadata
-func (f *FS) getMetadata(inode uint64) (*fuse.Attr, error) {
+func (f *FS) getMetadata(inode uint64) (*metadata, error) {
 	if inode == 0 {
 		return nil, fmt.Errorf("got zero inode")
 	}
-	key := PrefixMetadata + fmt.Sprint(inode)
-	attr := &fuse.Attr{}
+	attr := &metadata{}
 
-	if err := f.metadataStorager.Get(key, attr); err != nil {
+	if err := f.metadataStorager.Get(metadataKey(inode), attr); err != nil {
 		return nil, err
 	}
 	return attr, nil
 }
 
-// deleteMetadata
-func (f *FS) deleteMetadata(inode uint64) error {
-	key := PrefixMetadata + fmt.Sprint(inode)
-	return f.metadataStorager.Delete(key)
-}
-
-func (f *FS) getData(inode uint64) ([]byte, error) {
-	key := PrefixData + fmt.Sprint(inode)
-	return f.dataStorager.Bytes(key)
-}
-
-func (f *FS) writeData(inode uint64, val []byte) error {
-	key := PrefixData + fmt.Sprint(inode)
-	return f.dataStorager.PutBytes(key, val)
-}
-
 func getLogFilePath() string {
 	_, file, line, _ := runtime.Caller(2)
 	file = strings.TrimPrefix(file, os.Getenv("GOPATH")+"/src/github.com/ckeyer/tarofs/")
@@ -0,0 +1,168 @@
+package fs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// versions of the binary encodings, the first byte of an encoded value.
+const (
+	metadataVersion = 1
+	direntVersion   = 1
+)
+
+var errShortValue = errors.New("short binary value")
+
+// encoder appends varints, times and strings to buf.
+type encoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) time(t time.Time) {
+	n := binary.PutVarint(e.scratch[:], t.Unix())
+	e.buf = append(e.buf, e.scratch[:n]...)
+	e.uvarint(uint64(t.Nanosecond()))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// decoder reads what encoder wrote, the first failure sticks in err.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errShortValue
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	return uint32(d.uvarint())
+}
+
+func (d *decoder) time() time.Time {
+	if d.err != nil {
+		return time.Time{}
+	}
+	sec, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortValue
+		return time.Time{}
+	}
+	d.buf = d.buf[n:]
+	return time.Unix(sec, int64(d.uvarint()))
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = errShortValue
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// version reads the version byte and checks it against want.
+func (d *decoder) version(want byte) {
+	if len(d.buf) == 0 {
+		d.err = errShortValue
+		return
+	}
+	if d.buf[0] != want {
+		d.err = fmt.Errorf("unsupported encoding version %v", d.buf[0])
+		return
+	}
+	d.buf = d.buf[1:]
+}
+
+// MarshalBinary encodes the metadata as varints, the cache validity of the
+// attributes is not stored.
+func (m *metadata) MarshalBinary() ([]byte, error) {
+	e := &encoder{buf: make([]byte, 0, 64+len(m.Target))}
+	e.buf = append(e.buf, metadataVersion)
+	e.uvarint(m.Inode)
+	e.uvarint(m.Size)
+	e.uvarint(m.Blocks)
+	e.time(m.Atime)
+	e.time(m.Mtime)
+	e.time(m.Ctime)
+	e.time(m.Crtime)
+	e.uvarint(uint64(m.Mode))
+	e.uvarint(uint64(m.Nlink))
+	e.uvarint(uint64(m.Uid))
+	e.uvarint(uint64(m.Gid))
+	e.uvarint(uint64(m.Rdev))
+	e.uvarint(uint64(m.Flags))
+	e.uvarint(uint64(m.BlockSize))
+	e.string(m.Target)
+	return e.buf, nil
+}
+
+func (m *metadata) UnmarshalBinary(data []byte) error {
+	d := &decoder{buf: data}
+	d.version(metadataVersion)
+	*m = metadata{
+		Attr: fuse.Attr{
+			Inode:     d.uvarint(),
+			Size:      d.uvarint(),
+			Blocks:    d.uvarint(),
+			Atime:     d.time(),
+			Mtime:     d.time(),
+			Ctime:     d.time(),
+			Crtime:    d.time(),
+			Mode:      os.FileMode(d.uint32()),
+			Nlink:     d.uint32(),
+			Uid:       d.uint32(),
+			Gid:       d.uint32(),
+			Rdev:      d.uint32(),
+			Flags:     d.uint32(),
+			BlockSize: d.uint32(),
+		},
+		Target: d.string(),
+	}
+	return d.err
+}
+
+func (de *dirent) MarshalBinary() ([]byte, error) {
+	e := &encoder{buf: make([]byte, 0, 12)}
+	e.buf = append(e.buf, direntVersion)
+	e.uvarint(de.Inode)
+	e.uvarint(uint64(de.Type))
+	return e.buf, nil
+}
+
+func (de *dirent) UnmarshalBinary(data []byte) error {
+	d := &decoder{buf: data}
+	d.version(direntVersion)
+	de.Inode = d.uvarint()
+	de.Type = fuse.DirentType(d.uint32())
+	return d.err
+}
@@ -0,0 +1,94 @@
+package fs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+func testMetadata() *metadata {
+	now := time.Unix(1600000000, 123456789)
+	return &metadata{
+		Attr: fuse.Attr{
+			Inode:     42,
+			Size:      1 << 40,
+			Blocks:    8,
+			Atime:     now,
+			Mtime:     now.Add(time.Second),
+			Ctime:     now.Add(2 * time.Second),
+			Crtime:    now,
+			Mode:      os.ModeSymlink | os.ModeSticky | 0755,
+			Nlink:     3,
+			Uid:       1000,
+			Gid:       100,
+			Rdev:      1<<8 | 3,
+			BlockSize: 4096,
+		},
+		Target: "../target",
+	}
+}
+
+func TestMetadataBinary(t *testing.T) {
+	attr := testMetadata()
+	data, err := attr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &metadata{}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, tm := range []struct{ got, want time.Time }{
+		{got.Atime, attr.Atime}, {got.Mtime, attr.Mtime}, {got.Ctime, attr.Ctime}, {got.Crtime, attr.Crtime},
+	} {
+		if !tm.got.Equal(tm.want) {
+			t.Errorf("time %v, want %v", tm.got, tm.want)
+		}
+	}
+	got.Atime, got.Mtime, got.Ctime, got.Crtime = attr.Atime, attr.Mtime, attr.Ctime, attr.Crtime
+	if !reflect.DeepEqual(got, attr) {
+		t.Errorf("got %+v, want %+v", got, attr)
+	}
+
+	// a zero time stays zero.
+	zero := &metadata{}
+	if err := zero.UnmarshalBinary(mustMarshal(t, &metadata{})); err != nil || !zero.Mtime.IsZero() {
+		t.Errorf("zero time decoded as %v, %v", zero.Mtime, err)
+	}
+}
+
+func TestDirentBinary(t *testing.T) {
+	de := &dirent{Inode: 1 << 50, Type: fuse.DT_Dir}
+	got := &dirent{}
+	if err := got.UnmarshalBinary(mustMarshal(t, de)); err != nil || *got != *de {
+		t.Errorf("got %+v %v, want %+v", got, err, de)
+	}
+}
+
+func TestBinaryRejects(t *testing.T) {
+	data := mustMarshal(t, testMetadata())
+	for name, bad := range map[string][]byte{
+		"empty":     {},
+		"version":   append([]byte{metadataVersion + 1}, data[1:]...),
+		"truncated": data[:len(data)-3],
+	} {
+		if err := (&metadata{}).UnmarshalBinary(bad); err == nil {
+			t.Errorf("%s metadata decoded", name)
+		}
+	}
+	if err := (&dirent{}).UnmarshalBinary([]byte{direntVersion + 1, 1, 4}); err == nil {
+		t.Error("dirent of unknown version decoded")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{ MarshalBinary() ([]byte, error) }) []byte {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
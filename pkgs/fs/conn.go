@@ -4,28 +4,29 @@ import (
 	"bazil.org/fuse"
 )
 
-// Mount .
-func Mount(mountpoint string) (*fuse.Conn, error) {
-	return fuse.Mount(
-		mountpoint,
+// Mount mounts tarofs at mountpoint with the default options followed by
+// opts.
+func Mount(mountpoint string, opts ...fuse.MountOption) (*fuse.Conn, error) {
+	opts = append([]fuse.MountOption{
 		fuse.FSName("tarofs"),
 		fuse.VolumeName("Taro File System"),
 
 		fuse.LocalVolume(),
 
 		fuse.NoAppleDouble(),
-		fuse.NoAppleXattr(),
 
 		fuse.ExclCreate(),
 		fuse.DaemonTimeout("3600"),
 		fuse.AllowOther(),
 		fuse.AllowSUID(),
 
-		// fuse.DefaultPermissions(),
 		// fuse.MaxReadahead(1024*128), // TODO: not tested yet, possibly improving read performance
 		fuse.AsyncRead(),
-		fuse.WritebackCache(),
-	)
+		fuse.LockingFlock(),
+		fuse.LockingPOSIX(),
+	}, opts...)
+
+	return fuse.Mount(mountpoint, opts...)
 }
 
 // Umount .
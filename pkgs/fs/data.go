@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"fmt"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+// DefaultChunkSize is the chunk size of newly formatted volumes.
+const DefaultChunkSize = 256 << 10
+
+// chunkKey returns the data key of the idx-th chunk of inode.
+func chunkKey(inode, idx uint64) string {
+	return PrefixData + fmt.Sprintf("%d_%d", inode, idx)
+}
+
+// readChunk returns up to n bytes of a chunk from inner. A chunk that was
+// never written is a hole and reads as nil, a stored chunk may be shorter
+// than the chunk size when its tail was never written.
+func (f *FS) readChunk(inode, idx, inner uint64, n int) ([]byte, error) {
+	val, err := f.dataStorager.ReadAt(chunkKey(inode, idx), int64(inner), n)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	return val, err
+}
+
+// readAt reads up to n bytes at off from a file of the given size, only
+// the chunks covering the window are loaded.
+func (f *FS) readAt(inode, size uint64, off int64, n int) ([]byte, error) {
+	if off < 0 || uint64(off) >= size || n <= 0 {
+		return []byte{}, nil
+	}
+	end := uint64(off) + uint64(n)
+	if end > size {
+		end = size
+	}
+
+	var (
+		cs  = f.chunkSize
+		buf = make([]byte, end-uint64(off))
+	)
+	for pos := uint64(off); pos < end; {
+		idx, inner := pos/cs, pos%cs
+		chunkEnd := (idx + 1) * cs
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+
+		part, err := f.readChunk(inode, idx, inner, int(chunkEnd-pos))
+		if err != nil {
+			return nil, err
+		}
+		copy(buf[pos-uint64(off):], part)
+		pos = chunkEnd
+	}
+	return buf, nil
+}
+
+// writeAt writes data at off, chunks that are fully covered are replaced
+// and partially covered ones are patched in place.
+func (f *FS) writeAt(inode uint64, off int64, data []byte) error {
+	if off < 0 {
+		return fmt.Errorf("negative offset %v", off)
+	}
+
+	var (
+		cs  = f.chunkSize
+		end = uint64(off) + uint64(len(data))
+	)
+	for pos := uint64(off); pos < end; {
+		idx, inner := pos/cs, pos%cs
+		chunkEnd := (idx + 1) * cs
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+		part := data[pos-uint64(off) : chunkEnd-uint64(off)]
+
+		var err error
+		if inner == 0 && uint64(len(part)) == cs {
+			err = f.dataStorager.PutBytes(chunkKey(inode, idx), part)
+		} else {
+			err = f.dataStorager.WriteAt(chunkKey(inode, idx), int64(inner), part)
+		}
+		if err != nil {
+			return err
+		}
+		pos = chunkEnd
+	}
+	return nil
+}
+
+// deleteData drops every chunk of a file of the given size.
+func (f *FS) deleteData(inode, size uint64) error {
+	for idx := uint64(0); idx*f.chunkSize < size; idx++ {
+		if err := f.dataStorager.Delete(chunkKey(inode, idx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateData shrinks or extends the data of a file from size to n bytes.
+// Chunks past the new EOF are dropped and the boundary chunk is trimmed, so
+// stored chunks never hold bytes beyond EOF and an extension reads as a
+// hole.
+func (t *txn) truncateData(inode, size, n uint64) error {
+	if n >= size {
+		return nil
+	}
+
+	cs := t.chunkSize
+	if inner := n % cs; inner != 0 {
+		key := chunkKey(inode, n/cs)
+		val, err := t.dataStorager.Bytes(key)
+		if err != nil && err != storage.ErrNotFound {
+			return err
+		}
+		if uint64(len(val)) > inner {
+			if err := t.putChunk(key, val[:inner]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for idx := (n + cs - 1) / cs; idx*cs < size; idx++ {
+		if err := t.deleteChunk(chunkKey(inode, idx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ckeyer/tarofs/pkgs/storage/levelfs"
+)
+
+// TestResizeInTxn checks that a truncation leaves the data alone until its
+// txn commits with the new size.
+func TestResizeInTxn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := levelfs.NewLevelStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	usage, err := newUsageCounter(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &FS{metadataStorager: s, dataStorager: s, sharedData: true, chunkSize: 4, usage: usage}
+
+	data := []byte("0123456789")
+	attr := &metadata{}
+	attr.Inode, attr.Size, attr.Mode = 2, uint64(len(data)), 0644
+	if err := f.writeAt(attr.Inode, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.putMetadata(attr); err != nil {
+		t.Fatal(err)
+	}
+
+	// an abandoned txn changes nothing.
+	if err := f.begin().resize(attr, 3); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := f.readAt(attr.Inode, uint64(len(data)), 0, len(data)); err != nil || !bytes.Equal(val, data) {
+		t.Fatalf("data before commit got %q, %v", val, err)
+	}
+
+	attr.Size = uint64(len(data))
+	tx := f.begin()
+	if err := tx.resize(attr, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.commit(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.getMetadata(attr.Inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Size != 3 {
+		t.Fatalf("size got %v, want 3", got.Size)
+	}
+	for idx, want := range []int64{3, -1, -1} {
+		n, err := s.Size(chunkKey(attr.Inode, uint64(idx)))
+		if want < 0 && err == nil {
+			t.Fatalf("chunk %v left with %v bytes", idx, n)
+		} else if want >= 0 && (err != nil || n != want) {
+			t.Fatalf("chunk %v got %v bytes, %v, want %v", idx, n, err, want)
+		}
+	}
+
+	// extending again reads the dropped bytes as zeros.
+	if val, err := f.readAt(attr.Inode, 6, 0, 6); err != nil || !bytes.Equal(val, []byte("012\x00\x00\x00")) {
+		t.Fatalf("data after extension got %q, %v", val, err)
+	}
+}
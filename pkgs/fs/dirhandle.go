@@ -0,0 +1,140 @@
+package fs
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"unsafe"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// direntHeaderSize is the size of struct fuse_dirent without the name.
+const direntHeaderSize = 24
+
+var _ fs.NodeOpener = (*Dir)(nil)
+var _ fs.HandleReader = (*DirHandle)(nil)
+
+// DirHandle is an open directory. It streams the entries in name order,
+// the offset of an entry is its position after "." and "..". The names at
+// the offsets of the last read are kept as cursors, so sequential reads
+// seek straight to the next entry and other offsets are counted from the
+// start.
+type DirHandle struct {
+	*Dir
+
+	mu      sync.Mutex
+	cursors map[uint64]string
+}
+
+// Open returns a new handle for every open of the directory.
+func (d *Dir) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	d.log().Debugf("Open: %+v", req)
+	attr, err := d.getMetadata(d.inode)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkAccess(&req.Header, attr, openMask(req.Flags)); err != nil {
+		return nil, err
+	}
+	return &DirHandle{Dir: d, cursors: map[uint64]string{}}, nil
+}
+
+// Read encodes the entries from req.Offset on until req.Size is reached.
+func (dh *DirHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	dh.log().Debugf("Read: offset. %v size. %v", req.Offset, req.Size)
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+
+	var (
+		off  = uint64(req.Offset)
+		data = resp.Data[:0]
+	)
+	for ; off < 2; off++ {
+		de := fuse.Dirent{Inode: dh.inode, Type: fuse.DT_Dir, Name: "."}
+		if off == 1 {
+			// looked up now, the directory may have moved since it was
+			// opened.
+			parent, err := dh.getParent(dh.inode)
+			if err != nil {
+				dh.log(err).Errorf("Read: get parent failed.")
+				return err
+			}
+			de.Inode, de.Name = parent, ".."
+		}
+		next := appendDirent(data, de, off+1)
+		if len(next) > req.Size {
+			resp.Data = data
+			return nil
+		}
+		data = next
+	}
+
+	prefix := direntPrefix(dh.inode)
+	it := dh.metadataStorager.NewIterator(prefix)
+	defer it.Release()
+
+	var ok bool
+	if name, found := dh.cursors[off]; found {
+		key := prefix + name
+		if ok = it.Seek(key); ok && it.Key() == key {
+			ok = it.Next()
+		}
+	} else {
+		ok = it.Next()
+		for pos := uint64(2); ok && pos < off; pos++ {
+			ok = it.Next()
+		}
+	}
+
+	cursors := map[uint64]string{}
+	for ; ok; ok = it.Next() {
+		de := &dirent{}
+		if err := it.Value(de); err != nil {
+			return err
+		}
+		name := it.Key()[len(prefix):]
+		next := appendDirent(data, fuse.Dirent{Inode: de.Inode, Type: de.Type, Name: name}, off+1)
+		if len(next) > req.Size {
+			break
+		}
+		data, off = next, off+1
+		cursors[off] = name
+	}
+	if err := it.Error(); err != nil {
+		dh.log(err).Errorf("Read: list dirents failed.")
+		return err
+	}
+
+	if len(cursors) > 0 {
+		dh.cursors = cursors
+	}
+	resp.Data = data
+	return nil
+}
+
+// nativeEndian is the byte order of the kernel structures.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}()
+
+// appendDirent encodes de as a struct fuse_dirent with the offset of the
+// entry that follows it, in the native byte order like fuse.AppendDirent.
+func appendDirent(data []byte, de fuse.Dirent, off uint64) []byte {
+	var hdr [direntHeaderSize]byte
+	nativeEndian.PutUint64(hdr[0:], de.Inode)
+	nativeEndian.PutUint64(hdr[8:], off)
+	nativeEndian.PutUint32(hdr[16:], uint32(len(de.Name)))
+	nativeEndian.PutUint32(hdr[20:], uint32(de.Type))
+	data = append(data, hdr[:]...)
+	data = append(data, de.Name...)
+	if pad := (direntHeaderSize + len(de.Name)) % 8; pad != 0 {
+		data = append(data, make([]byte, 8-pad)...)
+	}
+	return data
+}
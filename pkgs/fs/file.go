@@ -1,9 +1,6 @@
 package fs
 
 import (
-	"os"
-	"syscall"
-
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/sirupsen/logrus"
@@ -13,20 +10,23 @@ import (
 type File struct {
 	*FS
 
-	flogger *logrus.Logger
 	// fs.NodeRef
-	inode  uint64
-	path   string
-	isOpen bool
+	inode uint64
+	name  string
 }
 
+// fileLogger is shared by all files, nodes are used concurrently.
+var fileLogger = func() *logrus.Logger {
+	l := logrus.New()
+	// l.Formatter = new(logrus.JSONFormatter)
+	l.SetLevel(logrus.DebugLevel)
+	return l
+}()
+
 var _ fs.Node = (*File)(nil)
 var _ fs.FSInodeGenerator = (*File)(nil)
 var _ fs.NodeSetattrer = (*File)(nil)
 var _ fs.NodeOpener = (*File)(nil)
-var _ fs.Handle = (*File)(nil)
-var _ fs.HandleReader = (*File)(nil)
-var _ fs.NodeRemover = (*File)(nil)
 
 func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 	f.log().Debugf("file Attr: %+v", a)
@@ -39,51 +39,61 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 		"req":  req,
 		"resp": resp,
 	}).Debugf("file Setattr: req. %+v", req)
-	// if f.isOpen {
-	// 	return nil
-	// }
-	if req.Mode&^os.ModePerm != 0 {
-		return nil
-	}
 	return f.setattr(ctx, req, resp, f.inode)
 }
 
+// Open returns a new handle for every open of the file, O_TRUNC drops the
+// file data when the file is opened for writing.
 func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
 	f.log().Debugf("file Open: %+v", req)
-	if !req.Flags.IsReadOnly() {
-		return nil, fuse.Errno(syscall.EACCES)
+	attr, err := f.getMetadata(f.inode)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkAccess(&req.Header, attr, openMask(req.Flags)); err != nil {
+		return nil, err
+	}
+	if req.Flags&fuse.OpenTruncate != 0 && !req.Flags.IsReadOnly() {
+		if err := f.truncate(); err != nil {
+			f.log(err).Errorf("Open: truncate failed.")
+			return nil, err
+		}
 	}
 
-	f.isOpen = true
-	return f.Handler(), nil
+	return f.Handler(req.Flags), nil
 }
 
-func (f *File) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
-	f.log().Debugf("Remove: %+v", req)
-	return f.remove(ctx, req, f.path)
+// Handler returns a new handle of the file opened with flags, the handle
+// keeps the inode alive until it is released.
+func (f *File) Handler(flags fuse.OpenFlags) *FileHandle {
+	f.log().Debugf("Handler: %v", flags)
+	f.opened(f.inode)
+	return &FileHandle{File: f, flags: flags}
 }
 
-// Handler
-func (f *File) Handler() fs.Handle {
-	f.log().Debugf("Handler: ")
-	return f
+// truncate drops all data of the file.
+func (f *File) truncate() error {
+	defer f.locks.lock(f.inode)()
+	attr, err := f.getMetadata(f.inode)
+	if err != nil {
+		return err
+	}
+	t := f.begin()
+	if err := t.resize(attr, 0); err != nil {
+		return err
+	}
+	return t.commit()
 }
 
 func (f *File) log(err ...error) *logrus.Entry {
-	if f.flogger == nil {
-		f.flogger = logrus.New()
-		// f.flogger.Formatter = new(logrus.JSONFormatter)
-		f.flogger.SetLevel(logrus.DebugLevel)
-	}
 	fields := logrus.Fields{
-		"path":    f.path,
-		"inode":   f.inode,
-		"module":  "fs_file",
-		"is_open": f.isOpen,
-		"file":    getLogFilePath(),
+		"name":   f.name,
+		"inode":  f.inode,
+		"module": "fs_file",
+		"file":   getLogFilePath(),
 	}
 	if len(err) > 0 && err[0] != nil {
 		fields["error"] = err[0]
 	}
-	return f.flogger.WithFields(fields)
+	return fileLogger.WithFields(fields)
 }
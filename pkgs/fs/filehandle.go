@@ -2,72 +2,127 @@ package fs
 
 import (
 	"context"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 )
 
-var _ fs.Handle = (*File)(nil)
-var _ fs.HandleReader = (*File)(nil)
-var _ fs.HandleReadAller = (*File)(nil)
-var _ fs.HandleWriter = (*File)(nil)
+// FileHandle is an open file, every Open or Create of a File gets its own
+// handle carrying the open flags.
+type FileHandle struct {
+	*File
 
-var _ fs.HandleFlusher = (*File)(nil)
-var _ fs.HandleReleaser = (*File)(nil)
+	flags fuse.OpenFlags
+}
+
+var _ fs.Handle = (*FileHandle)(nil)
+var _ fs.HandleReader = (*FileHandle)(nil)
+var _ fs.HandleWriter = (*FileHandle)(nil)
 
-func (fh *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
-	fh.log().Debugf("Read: %+v", req)
+var _ fs.HandleFlusher = (*FileHandle)(nil)
+var _ fs.HandleReleaser = (*FileHandle)(nil)
 
-	val, err := fh.getData(fh.inode)
+// Read returns the window [req.Offset, req.Offset+req.Size) of the file,
+// truncated at EOF.
+func (fh *FileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	fh.log().Debugf("Read: offset. %v size. %v", req.Offset, req.Size)
+
+	attr, err := fh.getMetadata(fh.inode)
 	if err != nil {
+		fh.log(err).Errorf("Read: getMetadata failed.")
 		return err
 	}
 
+	val, err := fh.readAt(fh.inode, attr.Size, req.Offset, req.Size)
+	if err != nil {
+		fh.log(err).Errorf("Read: read data failed.")
+		return err
+	}
 	resp.Data = val
+	if err := fh.touchAtime(fh.inode); err != nil {
+		fh.log(err).Errorf("Read: update atime failed.")
+	}
 
 	fh.log().Debugf("Read: data length %v", len(resp.Data))
 	return nil
 }
 
-// ReadAll .
-func (fh *File) ReadAll(ctx context.Context) ([]byte, error) {
-	val, err := fh.getData(fh.inode)
+// Write to the file handle at req.Offset, a hole between the current EOF
+// and the offset reads as zeros. Handles opened with O_APPEND write at the
+// current EOF, unless the kernel writeback cache is on: the kernel then
+// resolves O_APPEND itself and writes dirty pages back at their offsets.
+func (fh *FileHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	fh.log().Debugf("Write: offset. %v length. %v", req.Offset, len(req.Data))
+	if fh.flags.IsReadOnly() {
+		return fuse.Errno(syscall.EBADF)
+	}
+
+	defer fh.locks.lock(fh.inode)()
+	attr, err := fh.getMetadata(fh.inode)
 	if err != nil {
-		return nil, err
+		fh.log(err).Errorf("Write: getMetadata failed.")
+		return err
 	}
-	fh.log().Debugf("ReadAll: data length %v", len(val))
-	return val, nil
-}
 
-// Write to the file handle
-func (fh *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	fh.log().Debugf("Write: offset. %v req. %+v", req.Offset, req)
+	offset := req.Offset
+	if fh.flags&fuse.OpenAppend != 0 && req.Flags&fuse.WriteCache == 0 && !fh.writebackCache() {
+		offset = int64(attr.Size)
+	}
+	end := uint64(offset) + uint64(len(req.Data))
+	var growth uint64
+	if end > attr.Size {
+		growth = end - attr.Size
+	}
+	if err := fh.checkSpace(growth); err != nil {
+		return err
+	}
 
-	fh.writeData(fh.inode, req.Data)
+	if err := fh.writeAt(fh.inode, offset, req.Data); err != nil {
+		fh.log(err).Errorf("Write: write data failed.")
+		return err
+	}
 
-	attr, _ := fh.getMetadata(fh.inode)
 	resp.Size = len(req.Data)
-	attr.Size = uint64(resp.Size)
-
-	if err := fh.putMetadata(attr); err != nil {
-		fh.log(err).Errorf("Write: putMetadata failed.")
+	now := time.Now()
+	attr.Mtime = now
+	attr.Ctime = now
+	t := fh.begin()
+	if growth > 0 {
+		attr.Size = end
+		t.addUsage(int64(growth), 0)
+	}
+	if err := t.putMetadata(attr); err != nil {
+		return err
+	}
+	if err := t.commit(); err != nil {
+		fh.log(err).Errorf("Write: update metadata failed.")
 		return err
 	}
 
-	fh.log().Debugf("Write: data length %v", len(req.Data))
-
+	fh.log().Debugf("Write: data length %v, file size %v", len(req.Data), attr.Size)
 	return nil
 }
 
-// Release .
-func (fh *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+// Release drops the flock locks of the handle and frees the inode when it
+// was unlinked while this was its last open handle.
+func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
 	fh.log().Debugf("Release: %+v", req)
+	if req.ReleaseFlags&fuse.ReleaseFlockUnlock != 0 {
+		fh.fileLocks.releaseOwner(fh.inode, req.LockOwner, true)
+	}
+	if err := fh.released(fh.inode); err != nil {
+		fh.log(err).Errorf("Release: free inode failed.")
+		return err
+	}
 	return nil
 }
 
-// Flush - experimenting with uploading at flush, this slows operations down till it has been
-// completely flushed
-func (fh *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+// Flush is called on every close of a file descriptor, which drops the
+// POSIX locks of the closing owner.
+func (fh *FileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
 	fh.log().Debugf("Flush: %+v.", req)
+	fh.fileLocks.releaseOwner(fh.inode, req.LockOwner, false)
 	return nil
 }
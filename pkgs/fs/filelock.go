@@ -0,0 +1,191 @@
+package fs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+var _ fs.HandleFlockLocker = (*FileHandle)(nil)
+var _ fs.HandlePOSIXLocker = (*FileHandle)(nil)
+
+// rangeLock is an advisory lock of owner on the bytes [start, end]. flock
+// locks and POSIX locks do not conflict with each other, the kernel sends
+// a flock as a lock of the whole file.
+type rangeLock struct {
+	owner      fuse.LockOwner
+	flock      bool
+	typ        fuse.LockType
+	start, end uint64
+	pid        int32
+}
+
+func (l *rangeLock) overlaps(start, end uint64) bool {
+	return l.start <= end && start <= l.end
+}
+
+// fileLocks are the locks of one inode, wait is closed whenever a lock is
+// dropped to wake up the waiters.
+type fileLocks struct {
+	locks []rangeLock
+	wait  chan struct{}
+}
+
+// lockTable keeps the advisory locks of all inodes in memory, they do not
+// survive a mount.
+type lockTable struct {
+	sync.Mutex
+	files map[uint64]*fileLocks
+}
+
+// conflict returns a lock of another owner that keeps lk from being
+// placed, or nil.
+func (t *lockTable) conflict(inode uint64, lk *rangeLock) *rangeLock {
+	fl, ok := t.files[inode]
+	if !ok {
+		return nil
+	}
+	for i := range fl.locks {
+		l := &fl.locks[i]
+		if l.owner == lk.owner || l.flock != lk.flock || !l.overlaps(lk.start, lk.end) {
+			continue
+		}
+		if l.typ == fuse.LockWrite || lk.typ == fuse.LockWrite {
+			return l
+		}
+	}
+	return nil
+}
+
+// set replaces the locks of the owner of lk on its range, a POSIX lock
+// splits the locks it covers partially. A lock of type LockUnlock only
+// drops the range.
+func (t *lockTable) set(inode uint64, lk *rangeLock) {
+	fl, ok := t.files[inode]
+	if !ok {
+		fl = &fileLocks{wait: make(chan struct{})}
+		t.files[inode] = fl
+	}
+
+	locks := fl.locks[:0:0]
+	dropped := false
+	for _, l := range fl.locks {
+		if l.owner != lk.owner || l.flock != lk.flock || !l.overlaps(lk.start, lk.end) {
+			locks = append(locks, l)
+			continue
+		}
+		dropped = true
+		if l.start < lk.start {
+			head := l
+			head.end = lk.start - 1
+			locks = append(locks, head)
+		}
+		if l.end > lk.end {
+			tail := l
+			tail.start = lk.end + 1
+			locks = append(locks, tail)
+		}
+	}
+	if lk.typ != fuse.LockUnlock {
+		locks = append(locks, *lk)
+	}
+	fl.locks = locks
+
+	if dropped {
+		close(fl.wait)
+		fl.wait = make(chan struct{})
+	}
+	if len(fl.locks) == 0 {
+		delete(t.files, inode)
+	}
+}
+
+// releaseOwner drops all flock or all POSIX locks of owner.
+func (t *lockTable) releaseOwner(inode uint64, owner fuse.LockOwner, flock bool) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.files[inode]; !ok {
+		return
+	}
+	t.set(inode, &rangeLock{owner: owner, flock: flock, typ: fuse.LockUnlock, end: ^uint64(0)})
+}
+
+func newRangeLock(owner fuse.LockOwner, lock fuse.FileLock, flags fuse.LockFlags) *rangeLock {
+	return &rangeLock{
+		owner: owner,
+		flock: flags&fuse.LockFlock != 0,
+		typ:   lock.Type,
+		start: lock.Start,
+		end:   lock.End,
+		pid:   lock.PID,
+	}
+}
+
+// Lock places a lock without waiting, it fails with EAGAIN when another
+// owner holds a conflicting lock.
+func (fh *FileHandle) Lock(ctx context.Context, req *fuse.LockRequest) error {
+	fh.log().Debugf("Lock: %+v", req)
+	lk := newRangeLock(req.LockOwner, req.Lock, req.LockFlags)
+
+	fh.fileLocks.Lock()
+	defer fh.fileLocks.Unlock()
+	if fh.fileLocks.conflict(fh.inode, lk) != nil {
+		return fuse.Errno(syscall.EAGAIN)
+	}
+	fh.fileLocks.set(fh.inode, lk)
+	return nil
+}
+
+// LockWait places a lock, waiting for conflicting locks to be dropped
+// until the request is interrupted.
+func (fh *FileHandle) LockWait(ctx context.Context, req *fuse.LockWaitRequest) error {
+	fh.log().Debugf("LockWait: %+v", req)
+	lk := newRangeLock(req.LockOwner, req.Lock, req.LockFlags)
+
+	for {
+		fh.fileLocks.Lock()
+		if fh.fileLocks.conflict(fh.inode, lk) == nil {
+			fh.fileLocks.set(fh.inode, lk)
+			fh.fileLocks.Unlock()
+			return nil
+		}
+		wait := fh.fileLocks.files[fh.inode].wait
+		fh.fileLocks.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return fuse.Errno(syscall.EINTR)
+		}
+	}
+}
+
+// Unlock drops the locks of the owner on the range.
+func (fh *FileHandle) Unlock(ctx context.Context, req *fuse.UnlockRequest) error {
+	fh.log().Debugf("Unlock: %+v", req)
+	lk := newRangeLock(req.LockOwner, req.Lock, req.LockFlags)
+
+	fh.fileLocks.Lock()
+	defer fh.fileLocks.Unlock()
+	fh.fileLocks.set(fh.inode, lk)
+	return nil
+}
+
+// QueryLock reports a lock that conflicts with the requested one, or
+// LockUnlock when it could be placed.
+func (fh *FileHandle) QueryLock(ctx context.Context, req *fuse.QueryLockRequest, resp *fuse.QueryLockResponse) error {
+	lk := newRangeLock(req.LockOwner, req.Lock, req.LockFlags)
+
+	fh.fileLocks.Lock()
+	defer fh.fileLocks.Unlock()
+	if l := fh.fileLocks.conflict(fh.inode, lk); l != nil {
+		resp.Lock = fuse.FileLock{Start: l.start, End: l.end, Type: l.typ, PID: l.pid}
+		return nil
+	}
+	resp.Lock = req.Lock
+	resp.Lock.Type = fuse.LockUnlock
+	return nil
+}
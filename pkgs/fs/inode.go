@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyInodeAllocator is the metadata key of the inode allocator state.
+const KeyInodeAllocator = "tarofs_allocator"
+
+// inodeLeaseSize is the number of inodes reserved by one write of the
+// allocator state, inodes of a lease that are not handed out before an
+// unmount or crash are skipped.
+const inodeLeaseSize = 1024
+
+// allocatorState is the persisted state of the inode allocator. Inode
+// numbers are not reused, the allocator fails with ENOSPC once they run out
+// and the generation reported to the kernel is kept by bazil.org/fuse.
+type allocatorState struct {
+	// Next is the first inode that is not leased yet.
+	Next uint64 `json:"next"`
+}
+
+// inodeAllocator hands out monotonic inode numbers from leases persisted
+// in the metadata store.
+type inodeAllocator struct {
+	sync.Mutex
+
+	ms    storage.MetadataStorager
+	state allocatorState
+	next  uint64
+}
+
+// newInodeAllocator loads the allocator state, a volume without one starts
+// after the largest inode it holds.
+func newInodeAllocator(ms storage.MetadataStorager) (*inodeAllocator, error) {
+	a := &inodeAllocator{ms: ms}
+	err := ms.Get(KeyInodeAllocator, &a.state)
+	if err == storage.ErrNotFound {
+		max, err := maxInode(ms)
+		if err != nil {
+			return nil, err
+		}
+		a.state = allocatorState{Next: max + 1}
+		logrus.Infof("init inode allocator at %v", a.state.Next)
+	} else if err != nil {
+		return nil, err
+	}
+
+	a.next = a.state.Next
+	return a, nil
+}
+
+// allocate returns a new inode number, ENOSPC when the inode numbers are
+// used up.
+func (a *inodeAllocator) allocate() (uint64, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.next == a.state.Next {
+		state := a.state
+		if state.Next > math.MaxUint64-inodeLeaseSize {
+			return 0, fuse.Errno(syscall.ENOSPC)
+		}
+		state.Next += inodeLeaseSize
+		if err := a.ms.Put(KeyInodeAllocator, &state); err != nil {
+			return 0, err
+		}
+		a.state = state
+	}
+
+	inode := a.next
+	a.next++
+	return inode, nil
+}
+
+// maxInode returns the largest inode with stored metadata, the root inode
+// when there is none.
+func maxInode(ms storage.MetadataStorager) (uint64, error) {
+	it := ms.NewIterator(PrefixMetadata)
+	defer it.Release()
+
+	var max uint64 = 1
+	for it.Next() {
+		inode, err := strconv.ParseUint(strings.TrimPrefix(it.Key(), PrefixMetadata), 10, 64)
+		if err != nil {
+			continue
+		}
+		if inode > max {
+			max = inode
+		}
+	}
+	return max, it.Error()
+}
+
+// newMetadata allocates an inode and returns its initial metadata.
+func (f *FS) newMetadata(mode os.FileMode, uid, gid uint32) (*metadata, error) {
+	if err := f.checkInodes(); err != nil {
+		return nil, err
+	}
+	inode, err := f.inodes.allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &metadata{
+		Attr: fuse.Attr{
+			Inode:  inode,
+			Atime:  now,
+			Mtime:  now,
+			Ctime:  now,
+			Crtime: now,
+			Mode:   mode,
+			Nlink:  1,
+			Uid:    uid,
+			Gid:    gid,
+		},
+	}, nil
+}
@@ -0,0 +1,90 @@
+package fs
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestInodeAllocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := openTestStore(t, dir)
+	defer ms.Close()
+	if err := ms.Put(metadataKey(7), &metadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newInodeAllocator(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(8); want < 8+inodeLeaseSize+2; want++ {
+		inode, err := a.allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inode != want {
+			t.Fatalf("allocate got %v, want %v", inode, want)
+		}
+	}
+
+	// a reloaded allocator skips the rest of the lease.
+	b, err := newInodeAllocator(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode, err := b.allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 8 + 2*uint64(inodeLeaseSize); inode != want {
+		t.Fatalf("allocate after reload got %v, want %v", inode, want)
+	}
+}
+
+func TestInodeAllocatorExhausted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := openTestStore(t, dir)
+	defer ms.Close()
+	last := uint64(math.MaxUint64 - inodeLeaseSize)
+	if err := ms.Put(KeyInodeAllocator, &allocatorState{Next: last}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newInodeAllocator(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < inodeLeaseSize; i++ {
+		if _, err := a.allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inode, err := a.allocate()
+	if err != fuse.Errno(syscall.ENOSPC) {
+		t.Fatalf("allocate got %v, %v, want ENOSPC", inode, err)
+	}
+
+	// the numbers are not handed out again after a remount either.
+	b, err := newInodeAllocator(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inode, err := b.allocate(); err != fuse.Errno(syscall.ENOSPC) {
+		t.Fatalf("allocate after reload got %v, %v, want ENOSPC", inode, err)
+	}
+}
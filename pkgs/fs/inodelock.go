@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"sort"
+	"sync"
+
+	"bazil.org/fuse"
+)
+
+// inodeLocks serializes the operations on an inode. An operation that
+// needs several inodes takes them in one call to lock, which always locks
+// in ascending inode order, whether they are directories or the inodes
+// they link: a rename can leave a directory with a smaller inode than its
+// child, so no parent-first order holds.
+type inodeLocks struct {
+	sync.Mutex
+	locks map[uint64]*inodeLock
+}
+
+// inodeLock is dropped from the map once no one holds or waits for it.
+type inodeLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the inodes in ascending order, an inode given twice is locked
+// once. It returns the function that unlocks them.
+func (l *inodeLocks) lock(inodes ...uint64) func() {
+	sorted := append([]uint64(nil), inodes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	held := make([]uint64, 0, len(sorted))
+	for i, inode := range sorted {
+		if i > 0 && inode == sorted[i-1] {
+			continue
+		}
+		l.get(inode).Lock()
+		held = append(held, inode)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			l.put(held[i])
+		}
+	}
+}
+
+func (l *inodeLocks) get(inode uint64) *inodeLock {
+	l.Lock()
+	defer l.Unlock()
+
+	il, ok := l.locks[inode]
+	if !ok {
+		il = &inodeLock{}
+		l.locks[inode] = il
+	}
+	il.refs++
+	return il
+}
+
+func (l *inodeLocks) put(inode uint64) {
+	l.Lock()
+	defer l.Unlock()
+
+	il := l.locks[inode]
+	il.Unlock()
+	if il.refs--; il.refs == 0 {
+		delete(l.locks, inode)
+	}
+}
+
+// entryRef is the entry name of the directory parent.
+type entryRef struct {
+	parent uint64
+	name   string
+}
+
+// lockEntries locks inodes together with the inodes linked by entries, all
+// in ascending order. The entries are looked up before locking and again
+// once the locks are held, it retries until they did not change in between.
+// It returns the linked inodes, 0 for a missing entry, and the function
+// that unlocks them.
+func (f *FS) lockEntries(inodes []uint64, entries ...entryRef) ([]uint64, func(), error) {
+	for {
+		linked, err := f.lookupEntries(entries)
+		if err != nil {
+			return nil, nil, err
+		}
+		all := append([]uint64(nil), inodes...)
+		for _, inode := range linked {
+			if inode != 0 {
+				all = append(all, inode)
+			}
+		}
+		unlock := f.locks.lock(all...)
+
+		again, err := f.lookupEntries(entries)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		same := true
+		for i := range linked {
+			same = same && linked[i] == again[i]
+		}
+		if same {
+			return linked, unlock, nil
+		}
+		unlock()
+	}
+}
+
+// lookupEntries returns the inodes linked by entries, 0 for a missing one.
+func (f *FS) lookupEntries(entries []entryRef) ([]uint64, error) {
+	linked := make([]uint64, len(entries))
+	for i, e := range entries {
+		de, err := f.getDirent(e.parent, e.name)
+		if err == fuse.ENOENT {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		linked[i] = de.Inode
+	}
+	return linked, nil
+}
@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLockEntriesOrder runs a rename out of a directory into its parent
+// against an rmdir of that directory, after a rename left the directory
+// with the smaller inode.
+func TestLockEntriesOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := openTestStore(t, dir)
+	defer ms.Close()
+	f := &FS{metadataStorager: ms, locks: inodeLocks{locks: map[uint64]*inodeLock{}}}
+	const parent, child, file = 5, 3, 9
+	if err := f.putDirent(parent, "x", child, os.ModeDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.putDirent(child, "a", file, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	run := func(inodes []uint64, entries ...entryRef) {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			linked, unlock, err := f.lockEntries(inodes, entries...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if linked[0] == 0 {
+				t.Errorf("entry %+v not found", entries[0])
+			}
+			unlock()
+		}
+	}
+	wg.Add(2)
+	go run([]uint64{child, parent}, entryRef{child, "a"}, entryRef{parent, "a"})
+	go run([]uint64{parent}, entryRef{parent, "x"})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lockEntries deadlocked")
+	}
+	if n := len(f.locks.locks); n != 0 {
+		t.Fatalf("%v locks left in the table", n)
+	}
+}
@@ -0,0 +1,106 @@
+package fs
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+var _ fs.NodeLinker = (*Dir)(nil)
+
+// openCounter counts the open handles of every inode, an unlinked inode
+// is only freed once its last handle is released.
+type openCounter struct {
+	sync.Mutex
+
+	count map[uint64]int
+}
+
+// Link adds the entry req.NewName to d for the inode of old, directories
+// can not be linked. An inode that lost its last link is only kept for its
+// open handles and can not be linked again.
+func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	d.log().Debugf("Link: %+v", req)
+	var inode uint64
+	switch n := old.(type) {
+	case *File:
+		inode = n.inode
+	case *Symlink:
+		inode = n.inode
+	default:
+		return nil, fuse.Errno(syscall.EPERM)
+	}
+
+	defer d.locks.lock(d.inode, inode)()
+	if _, err := d.checkDirWrite(&req.Header, d.inode); err != nil {
+		return nil, err
+	}
+	t := d.begin()
+	attr, err := t.getMetadata(inode)
+	if err != nil {
+		d.log(err).Errorf("Link: getMetadata failed.")
+		return nil, err
+	}
+	if attr.Nlink == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	if err := t.putDirent(d.inode, req.NewName, inode, attr.Mode); err != nil {
+		d.log(err).Errorf("Link: put dirent %s failed.", req.NewName)
+		return nil, err
+	}
+	attr.Nlink++
+	attr.Ctime = time.Now()
+	// a linked inode is no orphan, whatever an older mount left behind.
+	t.batch.Delete(orphanKey(inode))
+	if err := t.putMetadata(attr); err != nil {
+		return nil, err
+	}
+	if err := t.touchDir(d.inode, attr.Ctime); err != nil {
+		return nil, err
+	}
+	if err := t.commit(); err != nil {
+		d.log(err).Errorf("Link: commit failed, %+v", attr)
+		return nil, err
+	}
+
+	return old, nil
+}
+
+// opened records a new open handle of inode.
+func (f *FS) opened(inode uint64) {
+	f.opens.Lock()
+	f.opens.count[inode]++
+	f.opens.Unlock()
+}
+
+// released records the release of a handle of inode, an inode that was
+// unlinked while open is freed with its last handle.
+func (f *FS) released(inode uint64) error {
+	defer f.locks.lock(inode)()
+	f.opens.Lock()
+	defer f.opens.Unlock()
+
+	if f.opens.count[inode]--; f.opens.count[inode] > 0 {
+		return nil
+	}
+	delete(f.opens.count, inode)
+
+	attr, err := f.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if attr.Nlink > 0 {
+		return nil
+	}
+
+	t := f.begin()
+	if err := t.freeInode(attr); err != nil {
+		return err
+	}
+	return t.commit()
+}
@@ -0,0 +1,213 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"bazil.org/fuse"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// legacyInode returns the inode of a path in the path keyed layout.
+func (f *FS) legacyInode(path string) (uint64, error) {
+	var inode uint64
+	if err := f.metadataStorager.Get(PrefixINode+path, &inode); err != nil {
+		return 0, err
+	}
+	return inode, nil
+}
+
+// legacyChildren returns the child names of a directory in the path keyed
+// layout.
+func (f *FS) legacyChildren(dir string) ([]string, error) {
+	children := []string{}
+	if err := f.metadataStorager.Get(PrefixPath+dir, &children); err != nil {
+		if err == storage.ErrNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return children, nil
+}
+
+// walkTree calls fn for every node below dir of the path keyed layout,
+// parents before children.
+func (f *FS) walkTree(dir string, dirInode uint64, fn func(parent uint64, path string, attr *metadata) error) error {
+	children, err := f.legacyChildren(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range children {
+		fullpath := filepath.Join(dir, name)
+		inode, err := f.legacyInode(fullpath)
+		if err != nil {
+			return fmt.Errorf("get inode of %s failed, %s", fullpath, err)
+		}
+		attr, err := f.getMetadata(inode)
+		if err != nil {
+			return fmt.Errorf("get metadata of %s failed, %s", fullpath, err)
+		}
+
+		if err := fn(dirInode, fullpath, attr); err != nil {
+			return err
+		}
+		if attr.Mode.IsDir() {
+			if err := f.walkTree(fullpath, inode, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateLegacyData splits the single tarofs_data_<inode> value of every
+// file into chunks.
+func (f *FS) migrateLegacyData() error {
+	return f.walkTree("/", 1, func(parent uint64, path string, attr *metadata) error {
+		if !attr.Mode.IsRegular() {
+			return nil
+		}
+
+		key := PrefixData + fmt.Sprint(attr.Inode)
+		val, err := f.dataStorager.Bytes(key)
+		if err == storage.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := f.writeAt(attr.Inode, 0, val); err != nil {
+			return err
+		}
+		if attr.Size != uint64(len(val)) {
+			attr.Size = uint64(len(val))
+			if err := f.putMetadata(attr); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("migrate data of %s, %v bytes", path, len(val))
+		return f.dataStorager.Delete(key)
+	})
+}
+
+// migrateLegacyNamespace converts a volume with path keyed inodes and
+// child lists into directory entries keyed by parent inode and name. The
+// child list of the root is dropped last, so an interrupted migration is
+// simply run again on the next mount.
+func (f *FS) migrateLegacyNamespace() error {
+	err := f.metadataStorager.Get(PrefixPath+"/", nil)
+	if err == storage.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logrus.Info("migrate path keyed namespace.")
+
+	legacyKeys := []string{}
+	dirs := []*metadata{}
+	err = f.walkTree("/", 1, func(parent uint64, path string, attr *metadata) error {
+		err := f.putDirent(parent, filepath.Base(path), attr.Inode, attr.Mode)
+		if err != nil && err != fuse.EEXIST {
+			return err
+		}
+
+		legacyKeys = append(legacyKeys, PrefixINode+path)
+		if attr.Mode.IsDir() {
+			legacyKeys = append(legacyKeys, PrefixPath+path)
+			dirs = append(dirs, attr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// legacy directories have a single link, they get one for "." and one
+	// for the ".." of every subdirectory like new ones.
+	for _, attr := range dirs {
+		subdirs, err := f.countSubdirs(attr.Inode)
+		if err != nil {
+			return err
+		}
+		attr.Nlink = 2 + subdirs
+		if err := f.putMetadata(attr); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range append(legacyKeys, PrefixPath+"/") {
+		if err := f.metadataStorager.Delete(key); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("migrate path keyed namespace, dropped %v legacy keys.", len(legacyKeys)+1)
+	return nil
+}
+
+// migrateBatchSize is the number of values MigrateFormat writes per batch.
+const migrateBatchSize = 1024
+
+// MigrateFormat rewrites the inode metadata and the directory entries of an
+// unmounted volume in their binary encoding and records FormatBinary in the
+// superblock. It returns the number of rewritten values, an interrupted
+// migration is simply run again.
+func MigrateFormat(ms storage.MetadataStorager) (int, error) {
+	sb := &superblock{}
+	if err := ms.Get(KeySuperblock, sb); err != nil {
+		return 0, fmt.Errorf("get superblock failed, %v", err)
+	}
+	if err := sb.check(); err != nil {
+		return 0, err
+	}
+	if sb.Format == FormatBinary {
+		return 0, nil
+	}
+
+	attrs, err := rewriteValues(ms, PrefixMetadata, func() interface{} { return &metadata{} })
+	if err != nil {
+		return attrs, err
+	}
+	dirents, err := rewriteValues(ms, PrefixDirent, func() interface{} { return &dirent{} })
+	if err != nil {
+		return attrs + dirents, err
+	}
+
+	sb.Format = FormatBinary
+	return attrs + dirents, ms.Put(KeySuperblock, sb)
+}
+
+// rewriteValues decodes every value with prefix into a new value and puts
+// it back. It walks a snapshot, so its own writes do not disturb the walk.
+func rewriteValues(ms storage.MetadataStorager, prefix string, newValue func() interface{}) (int, error) {
+	snap, err := ms.NewSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Release()
+	it := snap.NewIterator(prefix)
+	defer it.Release()
+
+	n := 0
+	b := ms.NewBatch()
+	for it.Next() {
+		v := newValue()
+		if err := it.Value(v); err != nil {
+			return n, fmt.Errorf("decode %s failed, %v", it.Key(), err)
+		}
+		if err := b.Put(it.Key(), v); err != nil {
+			return n, err
+		}
+		if n++; n%migrateBatchSize == 0 {
+			if err := ms.Write(b); err != nil {
+				return n, err
+			}
+			b = ms.NewBatch()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return n, err
+	}
+	return n, ms.Write(b)
+}
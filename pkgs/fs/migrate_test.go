@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/ckeyer/tarofs/pkgs/storage/levelfs"
+)
+
+// openTestStore opens the leveldb store in dir with opts, the caller closes
+// it.
+func openTestStore(t *testing.T, dir string, opts ...levelfs.Option) storage.MetadataStorager {
+	s, err := levelfs.NewLevelStorage(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// isBinary reports whether the value of key is in its binary encoding.
+func isBinary(t *testing.T, dir, key string) bool {
+	s, err := levelfs.NewLevelStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	data, err := s.Bytes(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(data) > 0 && data[0] == storage.BinaryMagic
+}
+
+func TestMigrateFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a JSON volume with one directory holding a file.
+	js := openTestStore(t, dir, levelfs.WithCodec(storage.JSONCodec))
+	attr := testMetadata()
+	for _, put := range []struct {
+		key string
+		v   interface{}
+	}{
+		{KeySuperblock, &superblock{Version: LayoutVersion, ChunkSize: DefaultChunkSize, Format: FormatJSON}},
+		{metadataKey(attr.Inode), attr},
+		{metadataKey(2), &metadata{}},
+		{direntKey(1, "f"), &dirent{Inode: attr.Inode, Type: direntType(attr.Mode)}},
+	} {
+		if err := js.Put(put.key, put.v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	js.Close()
+
+	// an interrupted migration leaves the metadata rewritten and the
+	// entries and the superblock as they were.
+	s := openTestStore(t, dir)
+	if n, err := rewriteValues(s, PrefixMetadata, func() interface{} { return &metadata{} }); err != nil || n != 2 {
+		t.Fatalf("rewrite metadata: %v %v", n, err)
+	}
+	s.Close()
+	if !isBinary(t, dir, metadataKey(attr.Inode)) || isBinary(t, dir, direntKey(1, "f")) {
+		t.Fatal("partial migration")
+	}
+
+	s = openTestStore(t, dir)
+	if n, err := MigrateFormat(s); err != nil || n != 3 {
+		t.Fatalf("migrate: %v %v", n, err)
+	}
+	got := &metadata{}
+	if err := s.Get(metadataKey(attr.Inode), got); err != nil || got.Target != attr.Target || got.Size != attr.Size {
+		t.Errorf("metadata %+v %v", got, err)
+	}
+	de := &dirent{}
+	if err := s.Get(direntKey(1, "f"), de); err != nil || de.Inode != attr.Inode {
+		t.Errorf("dirent %+v %v", de, err)
+	}
+	sb := &superblock{}
+	if err := s.Get(KeySuperblock, sb); err != nil || sb.Format != FormatBinary {
+		t.Errorf("superblock %+v %v", sb, err)
+	}
+
+	// a migrated volume is left alone.
+	if n, err := MigrateFormat(s); err != nil || n != 0 {
+		t.Errorf("migrate again: %v %v", n, err)
+	}
+	s.Close()
+	if !isBinary(t, dir, direntKey(1, "f")) {
+		t.Error("dirent is not binary")
+	}
+}
+
+func TestMigrateFormatRefuses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := openTestStore(t, dir)
+	defer s.Close()
+	if _, err := MigrateFormat(s); err == nil {
+		t.Error("migrate a store without superblock")
+	}
+	s.Put(KeySuperblock, &superblock{Version: LayoutVersion, Format: FormatBinary + 1})
+	if _, err := MigrateFormat(s); err == nil {
+		t.Error("migrate an unknown format")
+	}
+}
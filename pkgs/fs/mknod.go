@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+var _ fs.NodeMknoder = (*Dir)(nil)
+
+// Mknod creates the FIFO, socket or empty regular file req.Name, device
+// nodes are only created when the FS is configured with WithDevices.
+func (d *Dir) Mknod(ctx context.Context, req *fuse.MknodRequest) (fs.Node, error) {
+	d.log().Debugf("Mknod: %+v", req)
+	switch typ := req.Mode & os.ModeType; {
+	case typ == 0, typ == os.ModeNamedPipe, typ == os.ModeSocket:
+	case typ&os.ModeDevice != 0:
+		if !d.cfg.devices {
+			return nil, fuse.Errno(syscall.EPERM)
+		}
+	default:
+		return nil, fuse.Errno(syscall.EINVAL)
+	}
+
+	defer d.locks.lock(d.inode)()
+	dattr, err := d.checkDirWrite(&req.Header, d.inode)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := d.newMetadata(req.Mode, req.Uid, req.Gid)
+	if err != nil {
+		d.log(err).Errorf("Mknod: allocate inode failed.")
+		return nil, err
+	}
+	attr.Rdev = req.Rdev
+	inheritGroup(dattr, attr)
+
+	t := d.begin()
+	if err := t.createNode(d.inode, req.Name, attr); err != nil {
+		d.log(err).Errorf("Mknod: create %s failed, %+v", req.Name, attr)
+		return nil, err
+	}
+	if err := t.commit(); err != nil {
+		d.log(err).Errorf("Mknod: commit %s failed.", req.Name)
+		return nil, err
+	}
+
+	return &File{FS: d.FS, name: req.Name, inode: attr.Inode}, nil
+}
@@ -0,0 +1,123 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+
+	"bazil.org/fuse"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+// dirent is a directory entry, stored under the inode of its parent
+// directory and its name.
+type dirent struct {
+	Inode uint64          `json:"inode"`
+	Type  fuse.DirentType `json:"type"`
+}
+
+// direntPrefix returns the key prefix of all entries of the directory.
+func direntPrefix(parent uint64) string {
+	return PrefixDirent + fmt.Sprintf("%d_", parent)
+}
+
+func direntKey(parent uint64, name string) string {
+	return direntPrefix(parent) + name
+}
+
+// PrefixParent keys the parent directory of every directory but the root,
+// it answers ".." as the entries only lead from parents to children.
+const PrefixParent = "tarofs_parent_"
+
+func parentKey(inode uint64) string {
+	return PrefixParent + fmt.Sprint(inode)
+}
+
+// getParent returns the parent directory of the directory inode, the root
+// is its own parent.
+func (f *FS) getParent(inode uint64) (uint64, error) {
+	if inode == 1 {
+		return 1, nil
+	}
+	var parent uint64
+	if err := f.metadataStorager.Get(parentKey(inode), &parent); err != nil {
+		return 0, err
+	}
+	return parent, nil
+}
+
+// direntType returns the dirent type of a file mode.
+func direntType(mode os.FileMode) fuse.DirentType {
+	switch {
+	case mode.IsDir():
+		return fuse.DT_Dir
+	case mode.IsRegular():
+		return fuse.DT_File
+	case mode&os.ModeSymlink != 0:
+		return fuse.DT_Link
+	case mode&os.ModeNamedPipe != 0:
+		return fuse.DT_FIFO
+	case mode&os.ModeSocket != 0:
+		return fuse.DT_Socket
+	case mode&os.ModeCharDevice != 0:
+		return fuse.DT_Char
+	case mode&os.ModeDevice != 0:
+		return fuse.DT_Block
+	}
+	return fuse.DT_Unknown
+}
+
+// getDirent returns the entry name of the directory parent, or ENOENT.
+func (f *FS) getDirent(parent uint64, name string) (*dirent, error) {
+	de := &dirent{}
+	if err := f.metadataStorager.Get(direntKey(parent, name), de); err != nil {
+		if err == storage.ErrNotFound {
+			return nil, fuse.ENOENT
+		}
+		return nil, err
+	}
+	return de, nil
+}
+
+// putDirent links inode as name into the directory parent, it fails with
+// EEXIST when the name is taken.
+func (f *FS) putDirent(parent uint64, name string, inode uint64, mode os.FileMode) error {
+	key := direntKey(parent, name)
+	err := f.metadataStorager.Get(key, nil)
+	if err == nil {
+		return fuse.EEXIST
+	} else if err != storage.ErrNotFound {
+		return err
+	}
+
+	return f.metadataStorager.Put(key, &dirent{Inode: inode, Type: direntType(mode)})
+}
+
+// listDirents calls fn for every entry of the directory parent in name
+// order.
+func (f *FS) listDirents(parent uint64, fn func(name string, de *dirent) error) error {
+	prefix := direntPrefix(parent)
+	it := f.metadataStorager.NewIterator(prefix)
+	defer it.Release()
+
+	for it.Next() {
+		de := &dirent{}
+		if err := it.Value(de); err != nil {
+			return err
+		}
+		if err := fn(it.Key()[len(prefix):], de); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// hasDirents reports whether the directory has any entry.
+func (f *FS) hasDirents(parent uint64) (bool, error) {
+	it := f.metadataStorager.NewIterator(direntPrefix(parent))
+	defer it.Release()
+
+	if it.Next() {
+		return true, nil
+	}
+	return false, it.Error()
+}
@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// PrefixOrphan keys the inodes that lost their last link while open, they
+// are freed with their last handle or by the sweep of the next mount.
+const PrefixOrphan = "tarofs_orphan_"
+
+func orphanKey(inode uint64) string {
+	return PrefixOrphan + fmt.Sprint(inode)
+}
+
+// putOrphan records that the unlinked inode is kept for its open handles.
+func (t *txn) putOrphan(inode uint64) error {
+	return t.batch.Put(orphanKey(inode), inode)
+}
+
+// sweepOrphans frees the orphans left by a crash or an unclean unmount, no
+// handle survives a mount.
+func (f *FS) sweepOrphans() error {
+	it := f.metadataStorager.NewIterator(PrefixOrphan)
+	defer it.Release()
+
+	inodes := []uint64{}
+	for it.Next() {
+		inode, err := strconv.ParseUint(it.Key()[len(PrefixOrphan):], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad orphan key %s, %v", it.Key(), err)
+		}
+		inodes = append(inodes, inode)
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	for _, inode := range inodes {
+		t := f.begin()
+		attr, err := f.getMetadata(inode)
+		switch {
+		case err == storage.ErrNotFound:
+			t.batch.Delete(orphanKey(inode))
+		case err != nil:
+			return err
+		case attr.Nlink > 0:
+			// linked again before the crash.
+			t.batch.Delete(orphanKey(inode))
+		default:
+			if err := t.freeInode(attr); err != nil {
+				return err
+			}
+		}
+		if err := t.commit(); err != nil {
+			return err
+		}
+	}
+	if len(inodes) > 0 {
+		logrus.Infof("sweep %v orphan inodes.", len(inodes))
+	}
+	return nil
+}
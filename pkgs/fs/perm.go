@@ -0,0 +1,225 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// access mask bits of access(2).
+const (
+	accessRead  = 4
+	accessWrite = 2
+	accessExec  = 1
+)
+
+var _ fs.NodeAccesser = (*Dir)(nil)
+var _ fs.NodeAccesser = (*File)(nil)
+var _ fs.NodeAccesser = (*Symlink)(nil)
+
+// checkAccess fails with EACCES unless the caller of h may access attr
+// for mask, a combination of accessRead, accessWrite and accessExec. It
+// lets everything pass when the kernel checks the permissions.
+func (f *FS) checkAccess(h *fuse.Header, attr *metadata, mask uint32) error {
+	if f.cfg.defaultPermissions {
+		return nil
+	}
+
+	mask &= accessRead | accessWrite | accessExec
+	perm := uint32(attr.Mode.Perm())
+	if h.Uid == 0 {
+		// root only needs some execute bit to execute a file.
+		if mask&accessExec != 0 && !attr.Mode.IsDir() && perm&0111 == 0 {
+			return fuse.Errno(syscall.EACCES)
+		}
+		return nil
+	}
+
+	var granted uint32
+	switch {
+	case h.Uid == attr.Uid:
+		granted = perm >> 6
+	case inGroup(h, attr.Gid):
+		granted = perm >> 3
+	default:
+		granted = perm
+	}
+	if mask&^granted&7 != 0 {
+		return fuse.Errno(syscall.EACCES)
+	}
+	return nil
+}
+
+// inGroup reports whether the caller of h is a member of gid, by its
+// primary group or by the supplementary groups in /proc/<pid>/status. A
+// caller whose status can not be read only has its primary group.
+func inGroup(h *fuse.Header, gid uint32) bool {
+	if h.Gid == gid {
+		return true
+	}
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", h.Pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		for _, field := range strings.Fields(line[len("Groups:"):]) {
+			if g, err := strconv.ParseUint(field, 10, 32); err == nil && uint32(g) == gid {
+				return true
+			}
+		}
+		break
+	}
+	return false
+}
+
+// checkDirWrite checks that the caller of h may add or remove entries of
+// the directory inode.
+func (f *FS) checkDirWrite(h *fuse.Header, inode uint64) (*metadata, error) {
+	dattr, err := f.getMetadata(inode)
+	if err != nil {
+		return nil, err
+	}
+	return dattr, f.checkAccess(h, dattr, accessWrite|accessExec)
+}
+
+// checkSticky fails with EPERM when the entry attr of the sticky directory
+// dattr is neither owned by the caller of h nor in a directory it owns.
+func (f *FS) checkSticky(h *fuse.Header, dattr, attr *metadata) error {
+	if f.cfg.defaultPermissions || dattr.Mode&os.ModeSticky == 0 {
+		return nil
+	}
+	if h.Uid == 0 || h.Uid == dattr.Uid || h.Uid == attr.Uid {
+		return nil
+	}
+	return fuse.Errno(syscall.EPERM)
+}
+
+// checkOwner fails with EPERM unless the caller of h owns attr or is root.
+func (f *FS) checkOwner(h *fuse.Header, attr *metadata) error {
+	if f.cfg.defaultPermissions || h.Uid == 0 || h.Uid == attr.Uid {
+		return nil
+	}
+	return fuse.Errno(syscall.EPERM)
+}
+
+// checkSetattr applies the ownership rules of chmod, chown, truncate and
+// utimes to req.
+func (f *FS) checkSetattr(req *fuse.SetattrRequest, attr *metadata) error {
+	if req.Valid.Mode() {
+		if err := f.checkOwner(&req.Header, attr); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Uid() && req.Uid != attr.Uid && !f.cfg.defaultPermissions && req.Header.Uid != 0 {
+		return fuse.Errno(syscall.EPERM)
+	}
+	if req.Valid.Gid() && req.Gid != attr.Gid {
+		if err := f.checkOwner(&req.Header, attr); err != nil {
+			return err
+		}
+		if req.Header.Uid != 0 && !inGroup(&req.Header, req.Gid) && !f.cfg.defaultPermissions {
+			return fuse.Errno(syscall.EPERM)
+		}
+	}
+	if req.Valid.Size() && !req.Valid.Handle() {
+		if err := f.checkAccess(&req.Header, attr, accessWrite); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Atime() || req.Valid.Mtime() {
+		if f.checkOwner(&req.Header, attr) != nil {
+			// anyone with write access may touch to now.
+			if !req.Valid.AtimeNow() && !req.Valid.MtimeNow() {
+				return fuse.Errno(syscall.EPERM)
+			}
+			return f.checkAccess(&req.Header, attr, accessWrite)
+		}
+	}
+	return nil
+}
+
+// checkXattr checks that the caller of h may read or write the extended
+// attribute name of attr. user attributes follow the permission bits,
+// trusted attributes are for root only and security attributes are changed
+// by root only, other namespaces are changed by the owner.
+func (f *FS) checkXattr(h *fuse.Header, attr *metadata, name string, write bool) error {
+	if f.cfg.defaultPermissions {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(name, "user."):
+		if write {
+			return f.checkAccess(h, attr, accessWrite)
+		}
+		return f.checkAccess(h, attr, accessRead)
+	case strings.HasPrefix(name, "trusted."):
+		if h.Uid != 0 {
+			return fuse.Errno(syscall.EPERM)
+		}
+	case !write:
+	case strings.HasPrefix(name, "security."):
+		if h.Uid != 0 {
+			return fuse.Errno(syscall.EPERM)
+		}
+	default:
+		return f.checkOwner(h, attr)
+	}
+	return nil
+}
+
+// openMask returns the access mask needed to open with flags.
+func openMask(flags fuse.OpenFlags) uint32 {
+	switch {
+	case flags.IsReadOnly():
+		return accessRead
+	case flags.IsWriteOnly():
+		return accessWrite
+	}
+	return accessRead | accessWrite
+}
+
+// inheritGroup gives attr the group of a setgid parent directory dattr, a
+// new directory inherits the setgid bit too.
+func inheritGroup(dattr, attr *metadata) {
+	if dattr.Mode&os.ModeSetgid == 0 {
+		return
+	}
+	attr.Gid = dattr.Gid
+	if attr.Mode.IsDir() {
+		attr.Mode |= os.ModeSetgid
+	}
+}
+
+func (d *Dir) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	attr, err := d.getMetadata(d.inode)
+	if err != nil {
+		return err
+	}
+	return d.checkAccess(&req.Header, attr, req.Mask)
+}
+
+func (f *File) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	attr, err := f.getMetadata(f.inode)
+	if err != nil {
+		return err
+	}
+	return f.checkAccess(&req.Header, attr, req.Mask)
+}
+
+func (s *Symlink) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	attr, err := s.getMetadata(s.inode)
+	if err != nil {
+		return err
+	}
+	return s.checkAccess(&req.Header, attr, req.Mask)
+}
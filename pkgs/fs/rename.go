@@ -0,0 +1,147 @@
+package fs
+
+import (
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+var _ fs.NodeRenamer = (*Dir)(nil)
+
+// Rename moves req.OldName of d to req.NewName of newDir. An existing
+// target is replaced when it is of the same type, a directory target must
+// be empty.
+func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	d.log().Debugf("Rename: %+v", req)
+	nd, ok := newDir.(*Dir)
+	if !ok {
+		return fuse.Errno(syscall.ENOTDIR)
+	}
+	if d.inode == nd.inode && req.OldName == req.NewName {
+		return nil
+	}
+
+	_, unlock, err := d.lockEntries([]uint64{d.inode, nd.inode},
+		entryRef{d.inode, req.OldName}, entryRef{nd.inode, req.NewName})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dattr, err := d.checkDirWrite(&req.Header, d.inode)
+	if err != nil {
+		return err
+	}
+	ndattr, err := d.checkDirWrite(&req.Header, nd.inode)
+	if err != nil {
+		return err
+	}
+	t := d.begin()
+	de, err := t.getDirent(d.inode, req.OldName)
+	if err != nil {
+		return err
+	}
+	attr, err := t.getMetadata(de.Inode)
+	if err != nil {
+		d.log(err).Errorf("Rename: get metadata of %s failed.", req.OldName)
+		return err
+	}
+	if err := d.checkSticky(&req.Header, dattr, attr); err != nil {
+		return err
+	}
+	if target, err := t.getDirent(nd.inode, req.NewName); err == nil {
+		tattr, err := t.getMetadata(target.Inode)
+		if err != nil {
+			return err
+		}
+		if err := d.checkSticky(&req.Header, ndattr, tattr); err != nil {
+			return err
+		}
+	}
+
+	same, err := t.replaceTarget(nd.inode, req.NewName, de.Inode, attr)
+	if err != nil || same {
+		return err
+	}
+
+	t.deleteDirent(d.inode, req.OldName)
+	if err := t.putDirent(nd.inode, req.NewName, de.Inode, attr.Mode); err != nil {
+		d.log(err).Errorf("Rename: put dirent %s failed.", req.NewName)
+		return err
+	}
+	now := time.Now()
+	if err := t.touchCtime(de.Inode, now); err != nil {
+		return err
+	}
+	if err := t.touchDir(d.inode, now); err != nil {
+		return err
+	}
+	if err := t.touchDir(nd.inode, now); err != nil {
+		return err
+	}
+
+	if attr.Mode.IsDir() && d.inode != nd.inode {
+		// the ".." entry of the moved directory changes its parent.
+		if err := t.adjustNlink(d.inode, -1); err != nil {
+			return err
+		}
+		if err := t.adjustNlink(nd.inode, 1); err != nil {
+			return err
+		}
+		if err := t.batch.Put(parentKey(de.Inode), nd.inode); err != nil {
+			return err
+		}
+	}
+
+	if err := t.commit(); err != nil {
+		d.log(err).Errorf("Rename: commit %s failed.", req.NewName)
+		return err
+	}
+	return nil
+}
+
+// replaceTarget removes an existing entry name of the directory parent so
+// that inode with attr can be moved there, it reports whether the entry
+// already links inode, in which case rename does nothing.
+func (t *txn) replaceTarget(parent uint64, name string, inode uint64, attr *metadata) (bool, error) {
+	target, err := t.getDirent(parent, name)
+	if err == fuse.ENOENT {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if target.Inode == inode {
+		return true, nil
+	}
+
+	tattr, err := t.getMetadata(target.Inode)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case attr.Mode.IsDir() && !tattr.Mode.IsDir():
+		return false, fuse.Errno(syscall.ENOTDIR)
+	case !attr.Mode.IsDir() && tattr.Mode.IsDir():
+		return false, fuse.Errno(syscall.EISDIR)
+	case tattr.Mode.IsDir():
+		notEmpty, err := t.hasDirents(target.Inode)
+		if err != nil {
+			return false, err
+		}
+		if notEmpty {
+			return false, fuse.Errno(syscall.ENOTEMPTY)
+		}
+	}
+
+	t.deleteDirent(parent, name)
+	if tattr.Mode.IsDir() {
+		if err := t.freeInode(tattr); err != nil {
+			return false, err
+		}
+		return false, t.adjustNlink(parent, -1)
+	}
+	return false, t.unlink(tattr)
+}
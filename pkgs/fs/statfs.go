@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// KeyUsage is the metadata key of the space and inode usage.
+	KeyUsage = "tarofs_usage"
+
+	// statfsBlockSize is the block size reported by Statfs.
+	statfsBlockSize = 4096
+	// defaultCapacity and defaultMaxInodes are reported by Statfs when no
+	// limit is configured, they are not enforced.
+	defaultCapacity  = 1 << 50
+	defaultMaxInodes = 1 << 32
+	// nameMax is the longest name of a directory entry.
+	nameMax = 255
+)
+
+var _ fs.FSStatfser = (*FS)(nil)
+
+// usage is the space taken by file data and the number of inodes in use.
+type usage struct {
+	Bytes  uint64 `json:"bytes"`
+	Inodes uint64 `json:"inodes"`
+}
+
+// usageCounter keeps the usage in memory and writes it through to the
+// metadata store on every change.
+type usageCounter struct {
+	sync.Mutex
+
+	ms storage.MetadataStorager
+	usage
+}
+
+// newUsageCounter loads the usage, it is counted from the stored metadata
+// for volumes that do not have one yet.
+func newUsageCounter(ms storage.MetadataStorager) (*usageCounter, error) {
+	u := &usageCounter{ms: ms}
+	err := ms.Get(KeyUsage, &u.usage)
+	if err == nil {
+		return u, nil
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	it := ms.NewIterator(PrefixMetadata)
+	defer it.Release()
+	for it.Next() {
+		attr := &metadata{}
+		if err := it.Value(attr); err != nil {
+			return nil, err
+		}
+		u.Inodes++
+		if attr.Mode.IsRegular() {
+			u.Bytes += attr.Size
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("count usage, %v bytes, %v inodes", u.Bytes, u.Inodes)
+	return u, ms.Put(KeyUsage, &u.usage)
+}
+
+// write applies the batch b together with the usage changed by bytes and
+// inodes.
+func (u *usageCounter) write(b storage.Batch, bytes, inodes int64) error {
+	u.Lock()
+	defer u.Unlock()
+
+	next := u.usage
+	next.Bytes = addDelta(next.Bytes, bytes)
+	next.Inodes = addDelta(next.Inodes, inodes)
+	if next != u.usage {
+		if err := b.Put(KeyUsage, &next); err != nil {
+			return err
+		}
+	}
+	if err := u.ms.Write(b); err != nil {
+		return err
+	}
+	u.usage = next
+	return nil
+}
+
+func (u *usageCounter) get() usage {
+	u.Lock()
+	defer u.Unlock()
+	return u.usage
+}
+
+func addDelta(v uint64, delta int64) uint64 {
+	if delta < 0 && uint64(-delta) > v {
+		return 0
+	}
+	return uint64(int64(v) + delta)
+}
+
+// checkSpace fails with ENOSPC when growing the data by n bytes exceeds
+// the configured capacity.
+func (f *FS) checkSpace(n uint64) error {
+	if f.cfg.capacity == 0 || n == 0 {
+		return nil
+	}
+	if f.usage.get().Bytes+n > f.cfg.capacity {
+		return fuse.Errno(syscall.ENOSPC)
+	}
+	return nil
+}
+
+// checkInodes fails with ENOSPC when the configured inode limit is
+// reached.
+func (f *FS) checkInodes() error {
+	if f.cfg.maxInodes == 0 {
+		return nil
+	}
+	if f.usage.get().Inodes >= f.cfg.maxInodes {
+		return fuse.Errno(syscall.ENOSPC)
+	}
+	return nil
+}
+
+// Statfs reports the capacity and the inode limit against the usage.
+func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	var (
+		u         = f.usage.get()
+		capacity  = f.cfg.capacity
+		maxInodes = f.cfg.maxInodes
+		inodes    = u.Inodes
+	)
+	if capacity == 0 {
+		capacity = defaultCapacity
+	}
+	if maxInodes == 0 {
+		maxInodes = defaultMaxInodes
+	}
+
+	resp.Bsize = statfsBlockSize
+	resp.Frsize = statfsBlockSize
+	resp.Namelen = nameMax
+	resp.Blocks = capacity / statfsBlockSize
+	if used := (u.Bytes + statfsBlockSize - 1) / statfsBlockSize; used < resp.Blocks {
+		resp.Bfree = resp.Blocks - used
+	}
+	resp.Bavail = resp.Bfree
+	resp.Files = maxInodes
+	if inodes < maxInodes {
+		resp.Ffree = maxInodes - inodes
+	}
+	return nil
+}
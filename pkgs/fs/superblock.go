@@ -0,0 +1,296 @@
+package fs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// KeySuperblock is the metadata key of the volume superblock.
+const KeySuperblock = "tarofs_superblock"
+
+// LayoutVersion is the version of the on-disk layout, volumes of a newer
+// layout are refused. Superblocks without a version predate it and are
+// upgraded on mount.
+const LayoutVersion = 1
+
+// metadata formats of a volume.
+const (
+	// FormatJSON volumes may hold JSON encoded inode metadata and
+	// directory entries.
+	FormatJSON = 0
+	// FormatBinary volumes hold inode metadata and directory entries in
+	// their binary encoding only.
+	FormatBinary = 1
+)
+
+// Features of the layout that older builds do not understand, a volume
+// using a feature this build does not know is refused.
+const (
+	// FeatureRootMetadata volumes store the metadata of the root
+	// directory.
+	FeatureRootMetadata uint64 = 1 << iota
+	// FeatureParents volumes record the parent of every directory.
+	FeatureParents
+
+	knownFeatures = FeatureRootMetadata | FeatureParents
+)
+
+// superblock describes the on-disk layout of a volume, it is written when
+// the volume is formatted, upgraded or migrated.
+type superblock struct {
+	Version   int       `json:"version"`
+	UUID      string    `json:"uuid"`
+	Ctime     time.Time `json:"ctime"`
+	ChunkSize uint64    `json:"chunk_size"`
+	Format    int       `json:"format,omitempty"`
+	Features  uint64    `json:"features,omitempty"`
+}
+
+// check fails unless this build can mount a volume with the superblock.
+func (sb *superblock) check() error {
+	if sb.Version > LayoutVersion {
+		return fmt.Errorf("unsupported layout version %v", sb.Version)
+	}
+	if sb.Format > FormatBinary {
+		return fmt.Errorf("unsupported metadata format %v", sb.Format)
+	}
+	if unknown := sb.Features &^ knownFeatures; unknown != 0 {
+		return fmt.Errorf("unsupported features %#x", unknown)
+	}
+	return nil
+}
+
+// loadSuperblock reads the superblock of the volume, formatting the volume
+// when it has none yet.
+func (f *FS) loadSuperblock() error {
+	sb := &superblock{}
+	err := f.metadataStorager.Get(KeySuperblock, sb)
+	if err == storage.ErrNotFound {
+		return f.format()
+	} else if err != nil {
+		return err
+	}
+	if err := sb.check(); err != nil {
+		return err
+	}
+
+	if sb.Version < LayoutVersion {
+		if err := f.upgradeSuperblock(sb); err != nil {
+			return err
+		}
+	}
+	if sb.Format < FormatBinary {
+		logrus.Warnf("volume metadata is JSON encoded, run `tarofs migrate` to convert it.")
+	}
+	if f.cfg.chunkSize != 0 && f.cfg.chunkSize != sb.ChunkSize {
+		logrus.Warnf("volume chunk size is %v, ignore configured chunk size %v", sb.ChunkSize, f.cfg.chunkSize)
+	}
+	logrus.Infof("load volume %s, layout version %v, features %#x", sb.UUID, sb.Version, sb.Features)
+	f.sb = sb
+	f.chunkSize = sb.ChunkSize
+	return nil
+}
+
+// format writes a new superblock, volumes written before the superblock
+// existed are upgraded to the chunked data layout first and keep their
+// JSON metadata.
+func (f *FS) format() error {
+	uuid, err := newUUID()
+	if err != nil {
+		return err
+	}
+	sb := &superblock{
+		Version:   LayoutVersion,
+		UUID:      uuid,
+		Ctime:     time.Now(),
+		ChunkSize: f.cfg.chunkSize,
+		Format:    FormatBinary,
+	}
+	if sb.ChunkSize == 0 {
+		sb.ChunkSize = DefaultChunkSize
+	}
+	f.sb = sb
+	f.chunkSize = sb.ChunkSize
+
+	legacy, err := f.hasMetadata()
+	if err != nil {
+		return err
+	}
+	if legacy {
+		sb.Format = FormatJSON
+	}
+
+	if err := f.migrateLegacyData(); err != nil {
+		return err
+	}
+
+	logrus.Infof("format volume %s, chunk size %v, metadata format %v", sb.UUID, sb.ChunkSize, sb.Format)
+	return f.metadataStorager.Put(KeySuperblock, sb)
+}
+
+// upgradeSuperblock gives a superblock written before the layout was
+// versioned an identity, its creation time is the time of the upgrade.
+func (f *FS) upgradeSuperblock(sb *superblock) error {
+	uuid, err := newUUID()
+	if err != nil {
+		return err
+	}
+	sb.Version = LayoutVersion
+	sb.UUID = uuid
+	sb.Ctime = time.Now()
+
+	logrus.Infof("upgrade volume %s to layout version %v", sb.UUID, sb.Version)
+	return f.metadataStorager.Put(KeySuperblock, sb)
+}
+
+// hasMetadata reports whether any inode metadata is stored.
+func (f *FS) hasMetadata() (bool, error) {
+	it := f.metadataStorager.NewIterator(PrefixMetadata)
+	defer it.Release()
+	return it.Next(), it.Error()
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// createRoot stores the metadata of the root directory together with
+// FeatureRootMetadata. The root of an empty volume is owned by the mounting
+// user, the root of a volume with files stays writable by everyone as it
+// was before it had metadata, with the sticky bit so that users can not
+// remove or rename the entries of others.
+func (f *FS) createRoot() error {
+	if f.sb.Features&FeatureRootMetadata != 0 {
+		return nil
+	}
+	used, err := f.hasMetadata()
+	if err != nil {
+		return err
+	}
+	subdirs, err := f.countSubdirs(1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	attr := &metadata{
+		Attr: fuse.Attr{
+			Inode:  1,
+			Atime:  now,
+			Mtime:  now,
+			Ctime:  now,
+			Crtime: now,
+			Mode:   os.ModeDir | 0755,
+			Nlink:  2 + subdirs,
+			Uid:    uint32(os.Getuid()),
+			Gid:    uint32(os.Getgid()),
+		},
+	}
+	if used {
+		attr.Mode = os.ModeDir | os.ModeSticky | 0777
+	}
+
+	sb := *f.sb
+	sb.Features |= FeatureRootMetadata
+	t := f.begin()
+	if err := t.putMetadata(attr); err != nil {
+		return err
+	}
+	t.addUsage(0, 1)
+	if err := t.batch.Put(KeySuperblock, &sb); err != nil {
+		return err
+	}
+	if err := t.commit(); err != nil {
+		return err
+	}
+	f.sb = &sb
+
+	logrus.Infof("create root metadata, mode %v", attr.Mode)
+	return nil
+}
+
+// countSubdirs returns the number of subdirectories of the directory inode.
+func (f *FS) countSubdirs(inode uint64) (uint32, error) {
+	it := f.metadataStorager.NewIterator(direntPrefix(inode))
+	defer it.Release()
+
+	var n uint32
+	for it.Next() {
+		de := &dirent{}
+		if err := it.Value(de); err != nil {
+			return 0, err
+		}
+		if de.Type == fuse.DT_Dir {
+			n++
+		}
+	}
+	return n, it.Error()
+}
+
+// recordParents records the parent of every directory of a volume written
+// before the parents were kept, together with FeatureParents. The entries
+// are walked in batches, an interrupted run is simply run again.
+func (f *FS) recordParents() error {
+	if f.sb.Features&FeatureParents != 0 {
+		return nil
+	}
+	it := f.metadataStorager.NewIterator(PrefixDirent)
+	defer it.Release()
+
+	n := 0
+	b := f.metadataStorager.NewBatch()
+	for it.Next() {
+		de := &dirent{}
+		if err := it.Value(de); err != nil {
+			return fmt.Errorf("decode %s failed, %v", it.Key(), err)
+		}
+		if de.Type != fuse.DT_Dir {
+			continue
+		}
+		key := strings.TrimPrefix(it.Key(), PrefixDirent)
+		parent, err := strconv.ParseUint(key[:strings.Index(key, "_")], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad dirent key %s, %v", it.Key(), err)
+		}
+		if err := b.Put(parentKey(de.Inode), parent); err != nil {
+			return err
+		}
+		if n++; n%migrateBatchSize == 0 {
+			if err := f.metadataStorager.Write(b); err != nil {
+				return err
+			}
+			b = f.metadataStorager.NewBatch()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	sb := *f.sb
+	sb.Features |= FeatureParents
+	if err := b.Put(KeySuperblock, &sb); err != nil {
+		return err
+	}
+	if err := f.metadataStorager.Write(b); err != nil {
+		return err
+	}
+	f.sb = &sb
+
+	logrus.Infof("record the parents of %v directories.", n)
+	return nil
+}
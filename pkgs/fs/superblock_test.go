@@ -0,0 +1,164 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// loadVolume runs the mount steps that do not need FUSE on the store in
+// dir, the caller closes the store of the returned FS.
+func loadVolume(t *testing.T, dir string) (*FS, error) {
+	f := &FS{metadataStorager: openTestStore(t, dir), opens: openCounter{count: map[uint64]int{}}}
+	if err := f.loadSuperblock(); err != nil {
+		f.metadataStorager.Close()
+		return nil, err
+	}
+	usage, err := newUsageCounter(f.metadataStorager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.usage = usage
+	if err := f.createRoot(); err != nil {
+		return f, err
+	}
+	return f, f.recordParents()
+}
+
+func TestSuperblock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := loadVolume(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.sb.Version != LayoutVersion || f.sb.UUID == "" || f.sb.Features != FeatureRootMetadata|FeatureParents {
+		t.Errorf("superblock %+v", f.sb)
+	}
+	root, err := f.getMetadata(1)
+	if err != nil || root.Mode != os.ModeDir|0755 || root.Nlink != 2 || root.Uid != uint32(os.Getuid()) {
+		t.Fatalf("root %+v %v", root, err)
+	}
+	if u := f.usage.get(); u.Inodes != 1 {
+		t.Errorf("usage %+v", u)
+	}
+
+	// the root keeps its attributes across mounts.
+	root.Mode = os.ModeDir | 0700
+	if err := f.putMetadata(root); err != nil {
+		t.Fatal(err)
+	}
+	uuid := f.sb.UUID
+	f.metadataStorager.Close()
+
+	f, err = loadVolume(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, _ := f.getMetadata(1); root.Mode != os.ModeDir|0700 || f.sb.UUID != uuid || f.usage.get().Inodes != 1 {
+		t.Errorf("root %+v, superblock %+v after remount", root, f.sb)
+	}
+
+	// newer layouts and unknown features are refused.
+	s := f.metadataStorager
+	for _, sb := range []superblock{
+		{Version: LayoutVersion + 1},
+		{Version: LayoutVersion, Features: FeatureRootMetadata | 1<<10},
+	} {
+		if err := s.Put(KeySuperblock, &sb); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		if f, err := loadVolume(t, dir); err == nil {
+			f.metadataStorager.Close()
+			t.Fatalf("mounted %+v", sb)
+		}
+		s = openTestStore(t, dir)
+	}
+	s.Close()
+}
+
+func TestSuperblockUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a volume from before the layout version, with a directory in the
+	// root.
+	s := openTestStore(t, dir)
+	sub := &metadata{}
+	sub.Inode, sub.Mode, sub.Nlink = 2, os.ModeDir|0755, 2
+	s.Put(KeySuperblock, &superblock{ChunkSize: DefaultChunkSize})
+	s.Put(metadataKey(2), sub)
+	s.Put(direntKey(1, "sub"), &dirent{Inode: 2, Type: direntType(sub.Mode)})
+	s.Close()
+
+	f, err := loadVolume(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.metadataStorager.Close()
+	if f.sb.Version != LayoutVersion || f.sb.UUID == "" {
+		t.Errorf("superblock %+v", f.sb)
+	}
+	root, err := f.getMetadata(1)
+	if err != nil || root.Mode != os.ModeDir|os.ModeSticky|0777 || root.Nlink != 3 {
+		t.Errorf("root %+v %v", root, err)
+	}
+	if u := f.usage.get(); u.Inodes != 2 {
+		t.Errorf("usage %+v", u)
+	}
+}
+
+func TestRecordParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a volume written before the parents were kept.
+	ms := openTestStore(t, dir)
+	for _, put := range []struct {
+		parent uint64
+		name   string
+		inode  uint64
+		mode   os.FileMode
+	}{
+		{1, "a", 2, os.ModeDir},
+		{2, "b_c", 3, os.ModeDir},
+		{2, "f", 4, 0},
+	} {
+		if err := ms.Put(direntKey(put.parent, put.name), &dirent{Inode: put.inode, Type: direntType(put.mode)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sb := &superblock{Version: LayoutVersion, ChunkSize: DefaultChunkSize, Format: FormatBinary, Features: FeatureRootMetadata}
+	if err := ms.Put(KeySuperblock, sb); err != nil {
+		t.Fatal(err)
+	}
+	ms.Close()
+
+	f, err := loadVolume(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.metadataStorager.Close()
+	if f.sb.Features&FeatureParents == 0 {
+		t.Errorf("superblock %+v", f.sb)
+	}
+	for inode, want := range map[uint64]uint64{1: 1, 2: 1, 3: 2} {
+		if parent, err := f.getParent(inode); err != nil || parent != want {
+			t.Errorf("parent of %v got %v, %v, want %v", inode, parent, err, want)
+		}
+	}
+	if _, err := f.getParent(4); err == nil {
+		t.Errorf("file 4 has a parent recorded")
+	}
+}
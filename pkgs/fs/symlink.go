@@ -0,0 +1,94 @@
+package fs
+
+import (
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Symlink is a symbolic link, its target is kept in the metadata of its
+// inode.
+type Symlink struct {
+	*FS
+
+	inode uint64
+	name  string
+}
+
+// symlinkLogger is shared by all symbolic links, nodes are used
+// concurrently.
+var symlinkLogger = func() *logrus.Logger {
+	l := logrus.New()
+	l.SetLevel(logrus.DebugLevel)
+	return l
+}()
+
+var _ fs.Node = (*Symlink)(nil)
+var _ fs.NodeSetattrer = (*Symlink)(nil)
+var _ fs.NodeReadlinker = (*Symlink)(nil)
+var _ fs.NodeSymlinker = (*Dir)(nil)
+
+func (s *Symlink) Attr(ctx context.Context, a *fuse.Attr) error {
+	return s.attr(ctx, a, s.inode)
+}
+
+func (s *Symlink) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	s.log().Debugf("Setattr: %s", req)
+	return s.setattr(ctx, req, resp, s.inode)
+}
+
+// Readlink returns the target of the link.
+func (s *Symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	attr, err := s.getMetadata(s.inode)
+	if err != nil {
+		s.log(err).Errorf("Readlink: getMetadata failed.")
+		return "", err
+	}
+	return attr.Target, nil
+}
+
+func (s *Symlink) log(err ...error) *logrus.Entry {
+	fields := logrus.Fields{
+		"name":   s.name,
+		"inode":  s.inode,
+		"module": "fs_symlink",
+		"file":   getLogFilePath(),
+	}
+	if len(err) > 0 && err[0] != nil {
+		fields["error"] = err[0]
+	}
+	return symlinkLogger.WithFields(fields)
+}
+
+// Symlink creates the link req.NewName pointing to req.Target.
+func (d *Dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	d.log().Debugf("Symlink: %+v", req)
+	defer d.locks.lock(d.inode)()
+	dattr, err := d.checkDirWrite(&req.Header, d.inode)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := d.newMetadata(os.ModeSymlink|0777, req.Uid, req.Gid)
+	if err != nil {
+		d.log(err).Errorf("Symlink: allocate inode failed.")
+		return nil, err
+	}
+	attr.Size = uint64(len(req.Target))
+	attr.Target = req.Target
+	inheritGroup(dattr, attr)
+
+	t := d.begin()
+	if err := t.createNode(d.inode, req.NewName, attr); err != nil {
+		d.log(err).Errorf("Symlink: create %s failed, %+v", req.NewName, attr)
+		return nil, err
+	}
+	if err := t.commit(); err != nil {
+		d.log(err).Errorf("Symlink: commit %s failed.", req.NewName)
+		return nil, err
+	}
+
+	return &Symlink{FS: d.FS, name: req.NewName, inode: attr.Inode}, nil
+}
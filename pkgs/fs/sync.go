@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"fmt"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// SyncMode tells when writes are made durable.
+type SyncMode string
+
+const (
+	// SyncAlways makes every write durable before it returns, the storagers
+	// are expected to write synchronously and the kernel writeback cache
+	// is turned off so that every write(2) reaches the FS.
+	SyncAlways SyncMode = "always"
+	// SyncOnFsync makes writes durable on fsync(2) and fdatasync(2).
+	SyncOnFsync SyncMode = "on-fsync"
+	// SyncNever leaves durability to the storagers, fsync(2) is a no-op.
+	SyncNever SyncMode = "never"
+)
+
+// ParseSyncMode parses the name of a sync mode.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case SyncAlways, SyncOnFsync, SyncNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown sync mode %q", s)
+}
+
+// writebackCache tells whether the kernel writeback cache is on, it is
+// only off with SyncAlways.
+func (f *FS) writebackCache() bool {
+	return f.cfg.syncMode != SyncAlways
+}
+
+var _ fs.NodeFsyncer = (*File)(nil)
+var _ fs.NodeFsyncer = (*Dir)(nil)
+
+// Fsync persists the data and the metadata of the file, fdatasync(2) gets
+// the same treatment as the storagers have no cheaper way to flush data
+// alone.
+func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	f.log().Debugf("Fsync: %+v", req)
+	if err := f.sync(); err != nil {
+		f.log(err).Errorf("Fsync: sync failed.")
+		return err
+	}
+	return nil
+}
+
+// Fsync persists the entries and the metadata of the directory.
+func (d *Dir) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	d.log().Debugf("Fsync: %+v", req)
+	if err := d.sync(); err != nil {
+		d.log(err).Errorf("Fsync: sync failed.")
+		return err
+	}
+	return nil
+}
+
+// sync flushes both storagers unless the sync mode is never, the kernel
+// has already written back its dirty pages when fsync reaches the FS.
+func (f *FS) sync() error {
+	if f.cfg.syncMode == SyncNever {
+		return nil
+	}
+	if err := f.dataStorager.Sync(); err != nil {
+		return err
+	}
+	return f.metadataStorager.Sync()
+}
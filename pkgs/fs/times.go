@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"fmt"
+	"time"
+)
+
+// AtimePolicy tells when reads update the access time of a file.
+type AtimePolicy string
+
+const (
+	// AtimeNever never updates the access time on reads.
+	AtimeNever AtimePolicy = "noatime"
+	// AtimeRelative updates the access time when it is not newer than the
+	// modification or change time, or is older than a day.
+	AtimeRelative AtimePolicy = "relatime"
+	// AtimeStrict updates the access time on every read.
+	AtimeStrict AtimePolicy = "strictatime"
+)
+
+// relatimeInterval is the age after which relatime updates the access
+// time anyway.
+const relatimeInterval = 24 * time.Hour
+
+// ParseAtimePolicy parses the name of an atime policy.
+func ParseAtimePolicy(s string) (AtimePolicy, error) {
+	switch policy := AtimePolicy(s); policy {
+	case AtimeNever, AtimeRelative, AtimeStrict:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown atime policy %q", s)
+}
+
+// needsAtime reports whether a read at now updates the access time of attr.
+func (f *FS) needsAtime(attr *metadata, now time.Time) bool {
+	switch f.cfg.atime {
+	case AtimeNever:
+		return false
+	case AtimeStrict:
+		return true
+	}
+	return !attr.Atime.After(attr.Mtime) || !attr.Atime.After(attr.Ctime) ||
+		now.Sub(attr.Atime) >= relatimeInterval
+}
+
+// touchAtime records a read of inode according to the atime policy.
+func (f *FS) touchAtime(inode uint64) error {
+	now := time.Now()
+	attr, err := f.getMetadata(inode)
+	if err != nil || !f.needsAtime(attr, now) {
+		return err
+	}
+
+	defer f.locks.lock(inode)()
+	attr, err = f.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	attr.Atime = now
+	return f.putMetadata(attr)
+}
+
+// touchDir sets the modification and change time of a directory whose
+// entries change.
+func (t *txn) touchDir(inode uint64, now time.Time) error {
+	return t.touch(inode, now, true)
+}
+
+// touchCtime sets the change time of an inode whose metadata changes.
+func (t *txn) touchCtime(inode uint64, now time.Time) error {
+	return t.touch(inode, now, false)
+}
+
+func (t *txn) touch(inode uint64, now time.Time, mtime bool) error {
+	attr, err := t.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if mtime {
+		attr.Mtime = now
+	}
+	attr.Ctime = now
+	return t.putMetadata(attr)
+}
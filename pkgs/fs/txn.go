@@ -0,0 +1,243 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+// txn collects the metadata writes of one FS operation and commits them
+// with the usage change in a single batch. Entries and metadata read
+// through a txn see its own writes, a nil value marks a deletion.
+type txn struct {
+	*FS
+
+	batch   storage.Batch
+	dirents map[string]*dirent
+	attrs   map[uint64]*metadata
+	bytes   int64
+	inodes  int64
+	// freed are the regular files whose data is dropped after commit.
+	freed []*metadata
+}
+
+func (f *FS) begin() *txn {
+	return &txn{
+		FS:      f,
+		batch:   f.metadataStorager.NewBatch(),
+		dirents: map[string]*dirent{},
+		attrs:   map[uint64]*metadata{},
+	}
+}
+
+// commit writes the txn, the data of freed files is deleted once the
+// metadata no longer refers to it.
+func (t *txn) commit() error {
+	for key, de := range t.dirents {
+		if de == nil {
+			t.batch.Delete(key)
+		} else if err := t.batch.Put(key, de); err != nil {
+			return err
+		}
+	}
+	for inode, attr := range t.attrs {
+		if attr == nil {
+			t.batch.Delete(metadataKey(inode))
+		} else if err := t.batch.Put(metadataKey(inode), attr); err != nil {
+			return err
+		}
+	}
+	if err := t.usage.write(t.batch, t.bytes, t.inodes); err != nil {
+		return err
+	}
+
+	for _, attr := range t.freed {
+		if err := t.deleteData(attr.Inode, attr.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putChunk and deleteChunk change a chunk of file data. They go into the
+// batch when the data shares the metadata store, so that the data commits
+// with the metadata, a separate DataStorager is written right away.
+func (t *txn) putChunk(key string, val []byte) error {
+	if t.sharedData {
+		t.batch.PutBytes(key, val)
+		return nil
+	}
+	return t.dataStorager.PutBytes(key, val)
+}
+
+func (t *txn) deleteChunk(key string) error {
+	if t.sharedData {
+		t.batch.Delete(key)
+		return nil
+	}
+	return t.dataStorager.Delete(key)
+}
+
+func (t *txn) getDirent(parent uint64, name string) (*dirent, error) {
+	if de, ok := t.dirents[direntKey(parent, name)]; ok {
+		if de == nil {
+			return nil, fuse.ENOENT
+		}
+		return de, nil
+	}
+	return t.FS.getDirent(parent, name)
+}
+
+// putDirent links inode as name into the directory parent, it fails with
+// EEXIST when the name is taken.
+func (t *txn) putDirent(parent uint64, name string, inode uint64, mode os.FileMode) error {
+	if _, err := t.getDirent(parent, name); err == nil {
+		return fuse.EEXIST
+	} else if err != fuse.ENOENT {
+		return err
+	}
+	t.dirents[direntKey(parent, name)] = &dirent{Inode: inode, Type: direntType(mode)}
+	return nil
+}
+
+func (t *txn) deleteDirent(parent uint64, name string) {
+	t.dirents[direntKey(parent, name)] = nil
+}
+
+func (t *txn) getMetadata(inode uint64) (*metadata, error) {
+	if attr, ok := t.attrs[inode]; ok {
+		if attr == nil {
+			return nil, storage.ErrNotFound
+		}
+		return attr, nil
+	}
+	return t.FS.getMetadata(inode)
+}
+
+func (t *txn) putMetadata(attr *metadata) error {
+	if attr.Inode == 0 {
+		return fmt.Errorf("to set zero inode")
+	}
+	t.attrs[attr.Inode] = attr
+	return nil
+}
+
+func (t *txn) deleteMetadata(inode uint64) {
+	t.attrs[inode] = nil
+}
+
+// addUsage changes the usage by bytes and inodes on commit.
+func (t *txn) addUsage(bytes, inodes int64) {
+	t.bytes += bytes
+	t.inodes += inodes
+}
+
+// createNode links the new inode attr as name into the directory parent
+// and stores its metadata, a new directory records its parent.
+func (t *txn) createNode(parent uint64, name string, attr *metadata) error {
+	if err := t.putDirent(parent, name, attr.Inode, attr.Mode); err != nil {
+		return err
+	}
+	if err := t.putMetadata(attr); err != nil {
+		return err
+	}
+	if attr.Mode.IsDir() {
+		if err := t.batch.Put(parentKey(attr.Inode), parent); err != nil {
+			return err
+		}
+	}
+	t.addUsage(0, 1)
+	return t.touchDir(parent, attr.Ctime)
+}
+
+// adjustNlink adds delta to the link count of a directory, it is used for
+// the ".." entries of its subdirectories.
+func (t *txn) adjustNlink(inode uint64, delta int) error {
+	attr, err := t.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if delta < 0 && attr.Nlink < uint32(-delta) {
+		attr.Nlink = 0
+	} else {
+		attr.Nlink = uint32(int(attr.Nlink) + delta)
+	}
+	return t.putMetadata(attr)
+}
+
+// unlink drops one link of a non-directory inode, the inode and its data
+// are freed when the last link is gone and no handle is open, otherwise an
+// inode without links becomes an orphan.
+func (t *txn) unlink(attr *metadata) error {
+	if attr.Nlink > 0 {
+		attr.Nlink--
+	}
+	attr.Ctime = time.Now()
+
+	t.opens.Lock()
+	defer t.opens.Unlock()
+	if attr.Nlink > 0 {
+		return t.putMetadata(attr)
+	}
+	if t.opens.count[attr.Inode] > 0 {
+		if err := t.putOrphan(attr.Inode); err != nil {
+			return err
+		}
+		return t.putMetadata(attr)
+	}
+	return t.freeInode(attr)
+}
+
+// freeInode deletes the metadata and the extended attributes of an inode,
+// its data goes after commit.
+func (t *txn) freeInode(attr *metadata) error {
+	if err := t.deleteXattrs(attr.Inode); err != nil {
+		return err
+	}
+	t.deleteMetadata(attr.Inode)
+	t.batch.Delete(orphanKey(attr.Inode))
+	if attr.Mode.IsDir() {
+		t.batch.Delete(parentKey(attr.Inode))
+	}
+
+	var size int64
+	if attr.Mode.IsRegular() {
+		size = int64(attr.Size)
+		t.freed = append(t.freed, attr)
+	}
+	t.addUsage(-size, -1)
+	return nil
+}
+
+// deleteXattrs drops all extended attributes of an inode.
+func (t *txn) deleteXattrs(inode uint64) error {
+	it := t.metadataStorager.NewIterator(xattrPrefix(inode))
+	defer it.Release()
+
+	for it.Next() {
+		t.batch.Delete(it.Key())
+	}
+	return it.Error()
+}
+
+// resize sets the size of a regular file to n, dropping the data past n
+// and accounting the change in the usage. It counts as a modification.
+func (t *txn) resize(attr *metadata, n uint64) error {
+	if n > attr.Size {
+		if err := t.checkSpace(n - attr.Size); err != nil {
+			return err
+		}
+	} else if err := t.truncateData(attr.Inode, attr.Size, n); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	t.addUsage(int64(n)-int64(attr.Size), 0)
+	attr.Size = n
+	attr.Mtime = now
+	attr.Ctime = now
+	return t.putMetadata(attr)
+}
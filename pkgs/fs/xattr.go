@@ -0,0 +1,198 @@
+package fs
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"golang.org/x/net/context"
+)
+
+const (
+	// PrefixXattr keys the extended attributes of an inode by inode and
+	// attribute name.
+	PrefixXattr = "tarofs_xattr_"
+
+	// xattrNameMax and xattrSizeMax are the limits of linux, XATTR_NAME_MAX
+	// and XATTR_SIZE_MAX.
+	xattrNameMax = 255
+	xattrSizeMax = 64 << 10
+
+	// flags of setxattr(2), XATTR_CREATE and XATTR_REPLACE.
+	xattrCreate  = 0x1
+	xattrReplace = 0x2
+)
+
+var _ fs.NodeGetxattrer = (*Dir)(nil)
+var _ fs.NodeListxattrer = (*Dir)(nil)
+var _ fs.NodeSetxattrer = (*Dir)(nil)
+var _ fs.NodeRemovexattrer = (*Dir)(nil)
+
+var _ fs.NodeGetxattrer = (*File)(nil)
+var _ fs.NodeListxattrer = (*File)(nil)
+var _ fs.NodeSetxattrer = (*File)(nil)
+var _ fs.NodeRemovexattrer = (*File)(nil)
+
+var _ fs.NodeGetxattrer = (*Symlink)(nil)
+var _ fs.NodeListxattrer = (*Symlink)(nil)
+var _ fs.NodeSetxattrer = (*Symlink)(nil)
+var _ fs.NodeRemovexattrer = (*Symlink)(nil)
+
+func xattrPrefix(inode uint64) string {
+	return PrefixXattr + fmt.Sprintf("%d_", inode)
+}
+
+func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return d.getxattr(d.inode, req, resp)
+}
+
+func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return d.listxattr(d.inode, &req.Header, resp)
+}
+
+func (d *Dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	return d.setxattr(d.inode, req)
+}
+
+func (d *Dir) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return d.removexattr(d.inode, req)
+}
+
+func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return f.getxattr(f.inode, req, resp)
+}
+
+func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return f.listxattr(f.inode, &req.Header, resp)
+}
+
+func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	return f.setxattr(f.inode, req)
+}
+
+func (f *File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return f.removexattr(f.inode, req)
+}
+
+func (s *Symlink) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return s.getxattr(s.inode, req, resp)
+}
+
+func (s *Symlink) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return s.listxattr(s.inode, &req.Header, resp)
+}
+
+func (s *Symlink) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	return s.setxattr(s.inode, req)
+}
+
+func (s *Symlink) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return s.removexattr(s.inode, req)
+}
+
+func (f *FS) getxattr(inode uint64, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	attr, err := f.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if err := f.checkXattr(&req.Header, attr, req.Name, false); err != nil {
+		return err
+	}
+
+	var val []byte
+	if err := f.metadataStorager.Get(xattrPrefix(inode)+req.Name, &val); err != nil {
+		if err == storage.ErrNotFound {
+			return fuse.ErrNoXattr
+		}
+		return err
+	}
+	resp.Xattr = val
+	return nil
+}
+
+// listxattr lists the attribute names of an inode, trusted attributes are
+// only listed for root.
+func (f *FS) listxattr(inode uint64, h *fuse.Header, resp *fuse.ListxattrResponse) error {
+	prefix := xattrPrefix(inode)
+	it := f.metadataStorager.NewIterator(prefix)
+	defer it.Release()
+
+	for it.Next() {
+		name := it.Key()[len(prefix):]
+		if strings.HasPrefix(name, "trusted.") && h.Uid != 0 && !f.cfg.defaultPermissions {
+			continue
+		}
+		resp.Append(name)
+	}
+	return it.Error()
+}
+
+// setxattr stores an attribute, XATTR_CREATE fails on an existing and
+// XATTR_REPLACE on a missing attribute.
+func (f *FS) setxattr(inode uint64, req *fuse.SetxattrRequest) error {
+	if len(req.Name) == 0 || len(req.Name) > xattrNameMax {
+		return fuse.Errno(syscall.ERANGE)
+	}
+	if len(req.Xattr) > xattrSizeMax {
+		return fuse.Errno(syscall.E2BIG)
+	}
+
+	defer f.locks.lock(inode)()
+	attr, err := f.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if err := f.checkXattr(&req.Header, attr, req.Name, true); err != nil {
+		return err
+	}
+
+	key := xattrPrefix(inode) + req.Name
+	err = f.metadataStorager.Get(key, nil)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+	switch {
+	case err == nil && req.Flags&xattrCreate != 0:
+		return fuse.EEXIST
+	case err == storage.ErrNotFound && req.Flags&xattrReplace != 0:
+		return fuse.ErrNoXattr
+	}
+
+	t := f.begin()
+	if err := t.batch.Put(key, req.Xattr); err != nil {
+		return err
+	}
+	if err := t.touchCtime(inode, time.Now()); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+func (f *FS) removexattr(inode uint64, req *fuse.RemovexattrRequest) error {
+	defer f.locks.lock(inode)()
+	attr, err := f.getMetadata(inode)
+	if err != nil {
+		return err
+	}
+	if err := f.checkXattr(&req.Header, attr, req.Name, true); err != nil {
+		return err
+	}
+
+	key := xattrPrefix(inode) + req.Name
+	if err := f.metadataStorager.Get(key, nil); err != nil {
+		if err == storage.ErrNotFound {
+			return fuse.ErrNoXattr
+		}
+		return err
+	}
+	t := f.begin()
+	t.batch.Delete(key)
+	if err := t.touchCtime(inode, time.Now()); err != nil {
+		return err
+	}
+	return t.commit()
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+)
+
+// BinaryMagic is the first byte of a value in its binary encoding, no JSON
+// document starts with it.
+const BinaryMagic = 0xb1
+
+// Codec encodes the values of the metadata store.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes all values as JSON.
+	JSONCodec Codec = jsonCodec{}
+	// BinaryCodec encodes the values that implement
+	// encoding.BinaryMarshaler with their own encoding behind BinaryMagic
+	// and all others as JSON. It decodes both, so it reads the values
+	// written by JSONCodec.
+	BinaryCodec Codec = binaryCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(encoding.BinaryMarshaler)
+	if !ok {
+		return json.Marshal(v)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{BinaryMagic}, data...), nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != BinaryMagic {
+		return json.Unmarshal(data, v)
+	}
+	u, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("binary value decoded into %T", v)
+	}
+	return u.UnmarshalBinary(data[1:])
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// point has a binary encoding of two bytes.
+type point struct {
+	X, Y byte
+}
+
+func (p *point) MarshalBinary() ([]byte, error) {
+	return []byte{p.X, p.Y}, nil
+}
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	p.X, p.Y = data[0], data[1]
+	return nil
+}
+
+func TestBinaryCodec(t *testing.T) {
+	data, err := BinaryCodec.Marshal(&point{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string([]byte{BinaryMagic, 1, 2}) {
+		t.Errorf("binary value %v", data)
+	}
+	p := &point{}
+	if err := BinaryCodec.Unmarshal(data, p); err != nil || *p != (point{1, 2}) {
+		t.Errorf("decode binary value: %+v %v", p, err)
+	}
+
+	// values without a binary encoding are JSON.
+	data, err = BinaryCodec.Marshal(map[string]int{"a": 1})
+	if err != nil || string(data) != `{"a":1}` {
+		t.Errorf("JSON value %s %v", data, err)
+	}
+
+	// JSON values decode into types with a binary encoding.
+	data, _ = json.Marshal(&point{3, 4})
+	if err := BinaryCodec.Unmarshal(data, p); err != nil || *p != (point{3, 4}) {
+		t.Errorf("decode JSON value: %+v %v", p, err)
+	}
+
+	var m map[string]int
+	if err := BinaryCodec.Unmarshal([]byte{BinaryMagic, 1, 2}, &m); err == nil {
+		t.Error("binary value decoded into a type without a binary encoding")
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	data, err := JSONCodec.Marshal(&point{1, 2})
+	if err != nil || string(data) != `{"X":1,"Y":2}` {
+		t.Errorf("JSON value %s %v", data, err)
+	}
+	if _, err := JSONCodec.Marshal(func() {}); err == nil {
+		t.Error("marshal error is swallowed")
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// NewReaderAt returns an io.ReaderAt over the value of key.
+func NewReaderAt(ds DataStorager, key string) io.ReaderAt {
+	return &valueIO{ds: ds, key: key}
+}
+
+// NewWriterAt returns an io.WriterAt over the value of key.
+func NewWriterAt(ds DataStorager, key string) io.WriterAt {
+	return &valueIO{ds: ds, key: key}
+}
+
+type valueIO struct {
+	ds  DataStorager
+	key string
+}
+
+func (v *valueIO) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %v", off)
+	}
+	val, err := v.ds.ReadAt(v.key, off, len(p))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, val)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (v *valueIO) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %v", off)
+	}
+	if err := v.ds.WriteAt(v.key, off, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
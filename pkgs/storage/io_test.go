@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/ckeyer/tarofs/pkgs/storage/levelfs"
+)
+
+func TestValueIO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ds, err := levelfs.NewLevelStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	w := storage.NewWriterAt(ds, "k")
+	if n, err := w.WriteAt([]byte("world"), 6); err != nil || n != 5 {
+		t.Fatalf("write: %v %v", n, err)
+	}
+	if n, err := w.WriteAt([]byte("hello "), 0); err != nil || n != 6 {
+		t.Fatalf("write: %v %v", n, err)
+	}
+	if _, err := w.WriteAt([]byte("x"), -1); err == nil {
+		t.Error("write at negative offset")
+	}
+
+	r := storage.NewReaderAt(ds, "k")
+	buf := make([]byte, 5)
+	if n, err := r.ReadAt(buf, 6); err != nil || string(buf[:n]) != "world" {
+		t.Errorf("read: %q %v", buf[:n], err)
+	}
+	// a short read at the end of the value reports io.EOF.
+	if n, err := r.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "rld" {
+		t.Errorf("short read: %q %v", buf[:n], err)
+	}
+	if n, err := r.ReadAt(buf, 20); err != io.EOF || n != 0 {
+		t.Errorf("read past end: %v %v", n, err)
+	}
+	if _, err := storage.NewReaderAt(ds, "none").ReadAt(buf, 0); err != storage.ErrNotFound {
+		t.Errorf("read missing value: %v", err)
+	}
+	if _, err := r.ReadAt(buf, -1); err == nil {
+		t.Error("read at negative offset")
+	}
+}
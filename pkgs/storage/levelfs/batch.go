@@ -0,0 +1,57 @@
+package levelfs
+
+import (
+	"fmt"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var _ storage.Batch = (*leveldbBatch)(nil)
+
+// leveldbBatch encodes its values like Put and hands the writes to a
+// leveldb batch.
+type leveldbBatch struct {
+	batch *leveldb.Batch
+	codec storage.Codec
+}
+
+func (b *leveldbBatch) Put(key string, val interface{}) error {
+	data, err := b.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	b.batch.Put([]byte(key), data)
+	return nil
+}
+
+func (b *leveldbBatch) PutBytes(key string, val []byte) {
+	b.batch.Put([]byte(key), val)
+}
+
+func (b *leveldbBatch) Delete(key string) {
+	b.batch.Delete([]byte(key))
+}
+
+// NewBatch returns an empty batch of writes.
+func (f *leveldbStorage) NewBatch() storage.Batch {
+	return &leveldbBatch{batch: new(leveldb.Batch), codec: f.codec}
+}
+
+// Write applies all writes of the batch atomically.
+func (f *leveldbStorage) Write(b storage.Batch) error {
+	lb, ok := b.(*leveldbBatch)
+	if !ok {
+		return fmt.Errorf("unsupported batch %T", b)
+	}
+	if err := f.db.Write(lb.batch, f.wo); err != nil {
+		f.dblog(err).
+			WithField("len", lb.batch.Len()).
+			Debugf("write batch failed.")
+		return err
+	}
+	f.dblog().
+		WithField("len", lb.batch.Len()).
+		Debugf("write batch successful.")
+	return nil
+}
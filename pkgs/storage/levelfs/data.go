@@ -0,0 +1,70 @@
+package levelfs
+
+import (
+	"fmt"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+// leveldb stores values whole, the ranged operations read the value and
+// write back the patched copy.
+
+func (f *leveldbStorage) ReadAt(key string, off int64, n int) ([]byte, error) {
+	if off < 0 {
+		return nil, fmt.Errorf("negative offset %v", off)
+	}
+	val, err := f.Bytes(key)
+	if err != nil {
+		return nil, err
+	}
+	if off >= int64(len(val)) {
+		return []byte{}, nil
+	}
+	val = val[off:]
+	if n < len(val) {
+		val = val[:n]
+	}
+	return val, nil
+}
+
+func (f *leveldbStorage) WriteAt(key string, off int64, data []byte) error {
+	if off < 0 {
+		return fmt.Errorf("negative offset %v", off)
+	}
+	val, err := f.Bytes(key)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+	if end := off + int64(len(data)); int64(len(val)) < end {
+		val = append(val, make([]byte, end-int64(len(val)))...)
+	}
+	copy(val[off:], data)
+	return f.PutBytes(key, val)
+}
+
+func (f *leveldbStorage) Size(key string) (int64, error) {
+	val, err := f.Bytes(key)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(val)), nil
+}
+
+func (f *leveldbStorage) Truncate(key string, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("negative size %v", n)
+	}
+	val, err := f.Bytes(key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case int64(len(val)) > n:
+		val = val[:n]
+	case int64(len(val)) < n:
+		val = append(val, make([]byte, n-int64(len(val)))...)
+	default:
+		return nil
+	}
+	return f.PutBytes(key, val)
+}
@@ -0,0 +1,71 @@
+package levelfs
+
+import (
+	"testing"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+func TestRangedData(t *testing.T) {
+	s, done := newTestStorage(t)
+	defer done()
+
+	if _, err := s.ReadAt("k", 0, 1); err != storage.ErrNotFound {
+		t.Errorf("read missing value: %v", err)
+	}
+	if _, err := s.Size("k"); err != storage.ErrNotFound {
+		t.Errorf("size of missing value: %v", err)
+	}
+	if err := s.Truncate("k", 1); err != storage.ErrNotFound {
+		t.Errorf("truncate missing value: %v", err)
+	}
+
+	// a write past the end creates the value, the gap reads as zeros.
+	if err := s.WriteAt("k", 3, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Bytes("k"); string(v) != "\x00\x00\x00abc" {
+		t.Errorf("value %q after gap write", v)
+	}
+	if err := s.WriteAt("k", 1, []byte("xy")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Bytes("k"); string(v) != "\x00xyabc" {
+		t.Errorf("value %q after overwrite", v)
+	}
+
+	for _, c := range []struct {
+		off  int64
+		n    int
+		want string
+	}{
+		{1, 2, "xy"},
+		{4, 10, "bc"},
+		{6, 1, ""},
+		{9, 1, ""},
+	} {
+		v, err := s.ReadAt("k", c.off, c.n)
+		if err != nil || string(v) != c.want {
+			t.Errorf("read %v+%v: %q %v, want %q", c.off, c.n, v, err, c.want)
+		}
+	}
+	if _, err := s.ReadAt("k", -1, 1); err == nil {
+		t.Error("read at negative offset")
+	}
+
+	if n, err := s.Size("k"); err != nil || n != 6 {
+		t.Errorf("size %v %v", n, err)
+	}
+	if err := s.Truncate("k", 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Bytes("k"); string(v) != "\x00x" {
+		t.Errorf("value %q after shrink", v)
+	}
+	if err := s.Truncate("k", 4); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Bytes("k"); string(v) != "\x00x\x00\x00" {
+		t.Errorf("value %q after extend", v)
+	}
+}
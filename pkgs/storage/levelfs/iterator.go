@@ -0,0 +1,91 @@
+package levelfs
+
+import (
+	"bytes"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var _ storage.Iterator = (*leveldbIterator)(nil)
+
+// iteratorSource is implemented by both the db and its snapshots.
+type iteratorSource interface {
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+type leveldbIterator struct {
+	iterator.Iterator
+
+	codec   storage.Codec
+	reverse bool
+	started bool
+}
+
+// NewIterator returns an iterator over all keys with the given prefix.
+func (f *leveldbStorage) NewIterator(prefix string) storage.Iterator {
+	return newIterator(f.db, f.codec, storage.Range{Prefix: prefix})
+}
+
+// NewRangeIterator returns an iterator over the keys selected by r.
+func (f *leveldbStorage) NewRangeIterator(r storage.Range) storage.Iterator {
+	return newIterator(f.db, f.codec, r)
+}
+
+func newIterator(src iteratorSource, codec storage.Codec, r storage.Range) *leveldbIterator {
+	return &leveldbIterator{
+		Iterator: src.NewIterator(keyRange(r), nil),
+		codec:    codec,
+		reverse:  r.Reverse,
+	}
+}
+
+// keyRange narrows the range of the prefix to [r.Start, r.Limit).
+func keyRange(r storage.Range) *util.Range {
+	rg := util.BytesPrefix([]byte(r.Prefix))
+	if start := []byte(r.Start); bytes.Compare(start, rg.Start) > 0 {
+		rg.Start = start
+	}
+	if limit := []byte(r.Limit); len(limit) > 0 && (rg.Limit == nil || bytes.Compare(limit, rg.Limit) < 0) {
+		rg.Limit = limit
+	}
+	return rg
+}
+
+// Next moves to the next key, the first call moves to the first key of
+// the range, or to the last one when reversed.
+func (it *leveldbIterator) Next() bool {
+	if !it.reverse {
+		return it.Iterator.Next()
+	}
+	if !it.started {
+		it.started = true
+		return it.Iterator.Last()
+	}
+	return it.Iterator.Prev()
+}
+
+func (it *leveldbIterator) Seek(key string) bool {
+	it.started = true
+	ok := it.Iterator.Seek([]byte(key))
+	if !it.reverse {
+		return ok
+	}
+	if !ok {
+		return it.Iterator.Last()
+	}
+	if string(it.Iterator.Key()) > key {
+		return it.Iterator.Prev()
+	}
+	return true
+}
+
+func (it *leveldbIterator) Key() string {
+	return string(it.Iterator.Key())
+}
+
+func (it *leveldbIterator) Value(v interface{}) error {
+	return it.codec.Unmarshal(it.Iterator.Value(), v)
+}
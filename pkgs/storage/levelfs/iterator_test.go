@@ -0,0 +1,143 @@
+package levelfs
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ckeyer/tarofs/pkgs/storage"
+)
+
+// newTestStorage opens a storage in a temporary directory, the returned
+// function closes and removes it.
+func newTestStorage(t *testing.T) (*leveldbStorage, func()) {
+	dir, err := ioutil.TempDir("", "levelfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLevelStorage(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func putKeys(t *testing.T, s *leveldbStorage, keys ...string) {
+	for i, key := range keys {
+		if err := s.Put(key, i); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+}
+
+func collect(t *testing.T, it storage.Iterator) []string {
+	defer it.Release()
+	keys := []string{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestRangeIterator(t *testing.T) {
+	s, done := newTestStorage(t)
+	defer done()
+	putKeys(t, s, "a", "a_1", "a_2", "a_3", "a_4", "b_1")
+
+	for _, c := range []struct {
+		r    storage.Range
+		want []string
+	}{
+		{storage.Range{Prefix: "a_"}, []string{"a_1", "a_2", "a_3", "a_4"}},
+		{storage.Range{Prefix: "a_", Start: "a_2", Limit: "a_4"}, []string{"a_2", "a_3"}},
+		// Start and Limit outside of the prefix are clamped to it.
+		{storage.Range{Prefix: "a_", Start: "a", Limit: "c"}, []string{"a_1", "a_2", "a_3", "a_4"}},
+		{storage.Range{Prefix: "a_", Start: "b"}, []string{}},
+		{storage.Range{Start: "a_3"}, []string{"a_3", "a_4", "b_1"}},
+		{storage.Range{Prefix: "a_", Reverse: true}, []string{"a_4", "a_3", "a_2", "a_1"}},
+		{storage.Range{Prefix: "a_", Start: "a_2", Limit: "a_4", Reverse: true}, []string{"a_3", "a_2"}},
+		{storage.Range{Prefix: "c_", Reverse: true}, []string{}},
+	} {
+		if got := collect(t, s.NewRangeIterator(c.r)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v: got %v, want %v", c.r, got, c.want)
+		}
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	s, done := newTestStorage(t)
+	defer done()
+	putKeys(t, s, "a_1", "a_2", "a_3", "a_5", "b_1")
+
+	for _, c := range []struct {
+		r    storage.Range
+		seek string
+		ok   bool
+		want []string
+	}{
+		{storage.Range{Prefix: "a_"}, "a_3", true, []string{"a_3", "a_5"}},
+		{storage.Range{Prefix: "a_"}, "a_4", true, []string{"a_5"}},
+		{storage.Range{Prefix: "a_"}, "a_6", false, nil},
+		{storage.Range{Prefix: "a_", Reverse: true}, "a_3", true, []string{"a_3", "a_2", "a_1"}},
+		// a reverse seek between keys lands on the smaller one.
+		{storage.Range{Prefix: "a_", Reverse: true}, "a_4", true, []string{"a_3", "a_2", "a_1"}},
+		// past the end of the range it falls back to the last key.
+		{storage.Range{Prefix: "a_", Reverse: true}, "a_9", true, []string{"a_5", "a_3", "a_2", "a_1"}},
+		{storage.Range{Prefix: "a_", Reverse: true}, "a_0", false, nil},
+	} {
+		it := s.NewRangeIterator(c.r)
+		ok := it.Seek(c.seek)
+		if ok != c.ok {
+			it.Release()
+			t.Errorf("%+v seek %s: got %v, want %v", c.r, c.seek, ok, c.ok)
+			continue
+		}
+		if !ok {
+			it.Release()
+			continue
+		}
+		got := append([]string{it.Key()}, collect(t, it)...)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v seek %s: got %v, want %v", c.r, c.seek, got, c.want)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s, done := newTestStorage(t)
+	defer done()
+	putKeys(t, s, "a_1", "a_2")
+
+	snap, err := s.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	putKeys(t, s, "a_3")
+	if err := s.Delete("a_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := collect(t, snap.NewIterator("a_")), []string{"a_1", "a_2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot keys %v, want %v", got, want)
+	}
+	var v int
+	if err := snap.Get("a_1", &v); err != nil {
+		t.Errorf("get deleted key from snapshot: %v", err)
+	}
+	if err := snap.Get("a_3", &v); err != storage.ErrNotFound {
+		t.Errorf("get later key from snapshot: %v", err)
+	}
+	if got, want := collect(t, s.NewIterator("a_")), []string{"a_2", "a_3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("current keys %v, want %v", got, want)
+	}
+}
@@ -1,7 +1,6 @@
 package levelfs
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"runtime"
@@ -10,19 +9,46 @@ import (
 	"github.com/ckeyer/tarofs/pkgs/storage"
 	"github.com/sirupsen/logrus"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
+// keySync is written synchronously to flush the journal on Sync.
+const keySync = "levelfs_sync"
+
 var _ storage.MetadataStorager = (*leveldbStorage)(nil)
 var _ storage.DataStorager = (*leveldbStorage)(nil)
 
 type leveldbStorage struct {
-	mlog *logrus.Logger
-	db   *leveldb.DB
+	mlog  *logrus.Logger
+	db    *leveldb.DB
+	wo    *opt.WriteOptions
+	codec storage.Codec
 }
 
-func NewLevelStorage(leveldir string) (*leveldbStorage, error) {
-	m := &leveldbStorage{mlog: logrus.New()}
+// Option configures the leveldb storage.
+type Option func(*leveldbStorage)
+
+// WithCodec sets the encoding of the metadata values, storage.BinaryCodec
+// by default.
+func WithCodec(c storage.Codec) Option {
+	return func(l *leveldbStorage) {
+		l.codec = c
+	}
+}
+
+// WithSyncWrites makes every write wait until it reaches stable storage.
+func WithSyncWrites() Option {
+	return func(l *leveldbStorage) {
+		l.wo = &opt.WriteOptions{Sync: true}
+	}
+}
+
+func NewLevelStorage(leveldir string, opts ...Option) (*leveldbStorage, error) {
+	m := &leveldbStorage{mlog: logrus.New(), codec: storage.BinaryCodec}
 	m.mlog.SetLevel(logrus.WarnLevel)
+	for _, opt := range opts {
+		opt(m)
+	}
 
 	db, err := leveldb.OpenFile(leveldir, nil)
 	if err != nil {
@@ -46,7 +72,7 @@ func (l *leveldbStorage) Bytes(key string) ([]byte, error) {
 }
 
 func (f *leveldbStorage) PutBytes(key string, val []byte) error {
-	return f.db.Put([]byte(key), val, nil)
+	return f.db.Put([]byte(key), val, f.wo)
 }
 
 func (f *leveldbStorage) Get(key string, ret interface{}) error {
@@ -65,24 +91,32 @@ func (f *leveldbStorage) Get(key string, ret interface{}) error {
 		return nil
 	}
 
-	if err := jsonDecode(val, ret); err != nil {
+	if err := f.codec.Unmarshal(val, ret); err != nil {
+		f.dblog(err).
+			WithField("key", key).
+			Infof("decode failed.")
 		return err
 	}
 	return nil
 }
 
 func (f *leveldbStorage) Put(key string, val interface{}) error {
-	data := jsonEncode(val)
-	err := f.PutBytes(key, data)
+	data, err := f.codec.Marshal(val)
 	if err != nil {
 		f.dblog(err).
-			WithField("data", string(data)).
+			WithField("key", key).
+			Infof("encode failed.")
+		return err
+	}
+	if err := f.PutBytes(key, data); err != nil {
+		f.dblog(err).
+			WithField("len", len(data)).
 			WithField("key", key).
 			Debugf("put failed.")
 		return err
 	}
 	f.dblog().
-		WithField("data", string(data)).
+		WithField("len", len(data)).
 		WithField("key", key).
 		Debugf("put successful.")
 	return nil
@@ -90,13 +124,8 @@ func (f *leveldbStorage) Put(key string, val interface{}) error {
 
 // delete
 func (f *leveldbStorage) Delete(key string) error {
-	err := f.db.Delete([]byte(key), nil)
-	if err != leveldb.ErrNotFound {
-		f.dblog(err).
-			WithField("key", key).
-			Debugf("delete not found.")
-		return nil
-	} else if err != nil {
+	err := f.db.Delete([]byte(key), f.wo)
+	if err != nil {
 		f.dblog(err).
 			WithField("key", key).
 			Debugf("delete failed.")
@@ -108,17 +137,14 @@ func (f *leveldbStorage) Delete(key string) error {
 	return nil
 }
 
-func (f *leveldbStorage) Close() error {
-	return f.db.Close()
-}
-
-func jsonEncode(val interface{}) []byte {
-	bs, _ := json.Marshal(val)
-	return bs
+// Sync flushes all previous writes to stable storage, leveldb syncs its
+// journal up to a write made with the sync option.
+func (f *leveldbStorage) Sync() error {
+	return f.db.Put([]byte(keySync), nil, &opt.WriteOptions{Sync: true})
 }
 
-func jsonDecode(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+func (f *leveldbStorage) Close() error {
+	return f.db.Close()
 }
 
 func (f *leveldbStorage) dblog(err ...error) *logrus.Entry {
@@ -0,0 +1,47 @@
+package levelfs
+
+import (
+	"github.com/ckeyer/tarofs/pkgs/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var _ storage.Snapshot = (*leveldbSnapshot)(nil)
+
+type leveldbSnapshot struct {
+	snap  *leveldb.Snapshot
+	codec storage.Codec
+}
+
+// NewSnapshot returns a consistent read-only view of the current state.
+func (f *leveldbStorage) NewSnapshot() (storage.Snapshot, error) {
+	snap, err := f.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &leveldbSnapshot{snap: snap, codec: f.codec}, nil
+}
+
+func (s *leveldbSnapshot) Get(key string, ret interface{}) error {
+	val, err := s.snap.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return storage.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if ret == nil {
+		return nil
+	}
+	return s.codec.Unmarshal(val, ret)
+}
+
+func (s *leveldbSnapshot) NewIterator(prefix string) storage.Iterator {
+	return newIterator(s.snap, s.codec, storage.Range{Prefix: prefix})
+}
+
+func (s *leveldbSnapshot) NewRangeIterator(r storage.Range) storage.Iterator {
+	return newIterator(s.snap, s.codec, r)
+}
+
+func (s *leveldbSnapshot) Release() {
+	s.snap.Release()
+}
@@ -10,12 +10,77 @@ type MetadataStorager interface {
 	Get(key string, v interface{}) error
 	Put(key string, v interface{}) error
 	Delete(key string) error
+	NewIterator(prefix string) Iterator
+	// NewRangeIterator returns an iterator over the keys selected by r.
+	NewRangeIterator(r Range) Iterator
+	// NewSnapshot returns a consistent read-only view of the current
+	// state, later writes are not visible through it.
+	NewSnapshot() (Snapshot, error)
+	// NewBatch returns an empty batch of writes.
+	NewBatch() Batch
+	// Write applies all writes of the batch atomically.
+	Write(b Batch) error
+	// Sync flushes all previous writes to stable storage.
+	Sync() error
 	Close() error
 }
 
+// Range selects the keys with Prefix from Start up to but not including
+// Limit, an empty Limit does not bound the range. A reverse range is
+// walked in descending key order.
+type Range struct {
+	Prefix  string
+	Start   string
+	Limit   string
+	Reverse bool
+}
+
+// Snapshot is a read-only view of the metadata at one point in time. It
+// must be released after use.
+type Snapshot interface {
+	Get(key string, v interface{}) error
+	NewIterator(prefix string) Iterator
+	NewRangeIterator(r Range) Iterator
+	Release()
+}
+
+// Iterator walks the keys of a prefix or a Range in key order, or in
+// descending order for a reverse Range. It must be released after use.
+type Iterator interface {
+	Next() bool
+	// Seek moves to the first key not less than key, or the last key not
+	// greater than key when reversed, it reports whether there is one.
+	Seek(key string) bool
+	Key() string
+	Value(v interface{}) error
+	Error() error
+	Release()
+}
+
+// Batch collects puts and deletes that are applied together by Write, a
+// batch is not visible to readers before it is written.
+type Batch interface {
+	Put(key string, v interface{}) error
+	// PutBytes puts val as is, like the PutBytes of a DataStorager.
+	PutBytes(key string, val []byte)
+	Delete(key string)
+}
+
 type DataStorager interface {
 	Bytes(key string) ([]byte, error)
 	PutBytes(key string, val []byte) error
+	// ReadAt returns up to n bytes of the value of key from off, it is
+	// short when the value ends before off+n.
+	ReadAt(key string, off int64, n int) ([]byte, error)
+	// WriteAt writes data into the value of key at off, a missing value is
+	// created and a gap before off reads as zeros.
+	WriteAt(key string, off int64, data []byte) error
+	// Size returns the length of the value of key.
+	Size(key string) (int64, error)
+	// Truncate shrinks or zero extends the value of key to n bytes.
+	Truncate(key string, n int64) error
 	Delete(key string) error
+	// Sync flushes all previous writes to stable storage.
+	Sync() error
 	Close() error
 }
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+func (a *AppSuite) TestConcurrentNamespace() {
+	const workers, rounds = 8, 40
+	src, dst := a.absPath("stress_src"), a.absPath("stress_dst")
+	a.Require().Nil(os.Mkdir(src, 0755), "mkdir src")
+	a.Require().Nil(os.Mkdir(dst, 0755), "mkdir dst")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				name := fmt.Sprintf("w%d_%d", w, i)
+				if err := ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+					errs <- err
+					return
+				}
+				if err := os.Mkdir(filepath.Join(src, name+"_d"), 0755); err != nil {
+					errs <- err
+					return
+				}
+				if err := os.Rename(filepath.Join(src, name), filepath.Join(dst, name)); err != nil {
+					errs <- err
+					return
+				}
+				if err := os.Remove(filepath.Join(src, name+"_d")); err != nil {
+					errs <- err
+					return
+				}
+				if i%2 == 0 {
+					if err := os.Remove(filepath.Join(dst, name)); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		a.Require().Nil(err, "stress worker failed")
+	}
+
+	infos, err := ioutil.ReadDir(src)
+	a.Require().Nil(err, "read src")
+	a.Require().Len(infos, 0)
+
+	infos, err = ioutil.ReadDir(dst)
+	a.Require().Nil(err, "read dst")
+	a.Require().Len(infos, workers*rounds/2)
+	for _, info := range infos {
+		rbs, err := ioutil.ReadFile(filepath.Join(dst, info.Name()))
+		a.Require().Nil(err, "read %s", info.Name())
+		a.Require().Equal(info.Name(), string(rbs))
+	}
+
+	fi, err := os.Stat(src)
+	a.Require().Nil(err, "stat src")
+	a.Require().Equal(uint64(2), uint64(fi.Sys().(*syscall.Stat_t).Nlink))
+}
@@ -2,7 +2,9 @@ package tests
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"syscall"
 )
 
 type mkdirData struct {
@@ -82,3 +84,93 @@ func (a *AppSuite) TestMkdirWithMode() {
 		a.Require().Equal(info.Mode().Perm().String(), md.mode.String(), "check mode %s failed", md.mode)
 	}
 }
+
+func (a *AppSuite) TestRmdir() {
+	_, stderr, err := a.doExec("mkdir", "-p", "rmd/sub")
+	a.Require().Nil(err, "mkdir failed, %s %s", err, stderr)
+	err = ioutil.WriteFile(a.absPath("rmd/f"), []byte("f"), 0644)
+	a.Require().Nil(err, "write f")
+
+	err = syscall.Rmdir(a.absPath("rmd"))
+	a.Require().Equal(syscall.ENOTEMPTY, err)
+	err = syscall.Rmdir(a.absPath("rmd/f"))
+	a.Require().Equal(syscall.ENOTDIR, err)
+	err = syscall.Unlink(a.absPath("rmd/sub"))
+	a.Require().Equal(syscall.EISDIR, err)
+
+	a.Require().Nil(syscall.Rmdir(a.absPath("rmd/sub")), "rmdir sub")
+	a.Require().Nil(syscall.Unlink(a.absPath("rmd/f")), "unlink f")
+	a.Require().Nil(syscall.Rmdir(a.absPath("rmd")), "rmdir empty dir")
+	_, err = a.getFileInfo("rmd")
+	a.Require().True(os.IsNotExist(err), "dir still exists")
+}
+
+func (a *AppSuite) TestReadDirStream() {
+	const count = 300
+	a.Require().Nil(os.Mkdir(a.absPath("rd_big"), 0755), "mkdir")
+	for i := 0; i < count; i++ {
+		name := a.absPath(fmt.Sprintf("rd_big/entry_with_a_long_name_%04d", i))
+		a.Require().Nil(ioutil.WriteFile(name, nil, 0644), "create %s", name)
+	}
+
+	d, err := os.Open(a.absPath("rd_big"))
+	a.Require().Nil(err, "open dir")
+	defer d.Close()
+	names := []string{}
+	for {
+		batch, err := d.Readdirnames(7)
+		names = append(names, batch...)
+		if err != nil {
+			break
+		}
+	}
+	a.Require().Len(names, count)
+	for i, name := range names {
+		a.Require().Equal(fmt.Sprintf("entry_with_a_long_name_%04d", i), name)
+	}
+}
+
+func (a *AppSuite) TestRootAttr() {
+	info, err := os.Stat(a.rootDir)
+	a.Require().Nil(err, "stat root")
+	a.Require().True(info.IsDir())
+	nlink := info.Sys().(*syscall.Stat_t).Nlink
+	mode := info.Mode().Perm()
+
+	a.Require().Nil(os.Mkdir(a.absPath("root_sub"), 0755), "mkdir")
+	defer os.Remove(a.absPath("root_sub"))
+	info, err = os.Stat(a.rootDir)
+	a.Require().Nil(err, "stat root")
+	a.Require().Equal(nlink+1, info.Sys().(*syscall.Stat_t).Nlink)
+
+	a.Require().Nil(os.Chmod(a.rootDir, 0750), "chmod root")
+	defer os.Chmod(a.rootDir, mode)
+	info, err = os.Stat(a.rootDir)
+	a.Require().Nil(err, "stat root")
+	a.Require().Equal(os.FileMode(0750), info.Mode().Perm())
+}
+
+func (a *AppSuite) TestDotDot() {
+	a.Require().Nil(os.MkdirAll(a.absPath("dotdot/sub"), 0755), "mkdir")
+	parent, err := a.getFileInfo("dotdot")
+	a.Require().Nil(err, "stat dotdot")
+	sub, err := a.getFileInfo("dotdot/sub")
+	a.Require().Nil(err, "stat sub")
+
+	ents, err := a.readDirents(a.absPath("dotdot/sub"))
+	a.Require().Nil(err, "read dirents")
+	a.Require().Equal(sub.Sys().(*syscall.Stat_t).Ino, ents["."].ino)
+	a.Require().Equal(parent.Sys().(*syscall.Stat_t).Ino, ents[".."].ino)
+
+	// a directory moved while it is open reports its new parent.
+	a.Require().Nil(os.Mkdir(a.absPath("dotdot/moved"), 0755), "mkdir moved")
+	moved, err := a.getFileInfo("dotdot/moved")
+	a.Require().Nil(err, "stat moved")
+	d, err := os.Open(a.absPath("dotdot/sub"))
+	a.Require().Nil(err, "open sub")
+	defer d.Close()
+	a.Require().Nil(os.Rename(a.absPath("dotdot/sub"), a.absPath("dotdot/moved/sub")), "move sub")
+	ents, err = a.readDirentsOf(d)
+	a.Require().Nil(err, "read dirents of moved sub")
+	a.Require().Equal(moved.Sys().(*syscall.Stat_t).Ino, ents[".."].ino)
+}
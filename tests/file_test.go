@@ -1,8 +1,14 @@
 package tests
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"syscall"
+
+	"github.com/ckeyer/tarofs/pkgs/fs"
 )
 
 type touchData struct {
@@ -53,3 +59,165 @@ func (a *AppSuite) TestWriteRead() {
 		a.Require().Equal(string(rbs), string(v.Data), "file data")
 	}
 }
+
+func (a *AppSuite) TestWriteAtOffset() {
+	name := a.absPath("wr_offset")
+	f, err := os.Create(name)
+	a.Require().Nilf(err, "create %s failed.", name)
+
+	_, err = f.WriteAt([]byte("hello"), 0)
+	a.Require().Nil(err, "write at 0")
+	_, err = f.WriteAt([]byte("world"), 10)
+	a.Require().Nil(err, "write at 10")
+	_, err = f.WriteAt([]byte("HE"), 0)
+	a.Require().Nil(err, "overwrite at 0")
+
+	buf := make([]byte, 4)
+	n, err := f.ReadAt(buf, 3)
+	a.Require().Nil(err, "read at 3")
+	a.Require().Equal(4, n)
+	a.Require().Equal([]byte("lo\x00\x00"), buf)
+
+	a.Require().Nilf(f.Close(), "close %s failed.", name)
+
+	fi, err := os.Stat(name)
+	a.Require().Nilf(err, "stat %s failed.", name)
+	a.Require().Equal(int64(15), fi.Size(), "file size")
+
+	rbs, err := ioutil.ReadFile(name)
+	a.Require().Nilf(err, "read %s failed.", name)
+	a.Require().Equal("HEllo\x00\x00\x00\x00\x00world", string(rbs), "file data")
+}
+
+func (a *AppSuite) TestWriteReadLarge() {
+	name := a.absPath("wr_large")
+	data := make([]byte, fs.DefaultChunkSize*3+1234)
+	rand.Read(data)
+
+	err := ioutil.WriteFile(name, data, 0644)
+	a.Require().Nilf(err, "write %s failed.", name)
+
+	fi, err := os.Stat(name)
+	a.Require().Nilf(err, "stat %s failed.", name)
+	a.Require().Equal(int64(len(data)), fi.Size(), "file size")
+
+	rbs, err := ioutil.ReadFile(name)
+	a.Require().Nilf(err, "read %s failed.", name)
+	a.Require().True(bytes.Equal(data, rbs), "file data")
+}
+
+func (a *AppSuite) TestOpenForWrite() {
+	name := a.absPath("wr_reopen")
+	err := ioutil.WriteFile(name, []byte("0123456789"), 0644)
+	a.Require().Nilf(err, "write %s failed.", name)
+
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	a.Require().Nilf(err, "open %s O_WRONLY failed.", name)
+	_, err = f.WriteAt([]byte("ab"), 2)
+	a.Require().Nil(err, "write at 2")
+	a.Require().Nil(f.Close())
+
+	rbs, err := ioutil.ReadFile(name)
+	a.Require().Nil(err)
+	a.Require().Equal("01ab456789", string(rbs))
+
+	f, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	a.Require().Nilf(err, "open %s O_APPEND failed.", name)
+	_, err = f.Write([]byte("xyz"))
+	a.Require().Nil(err, "append")
+	a.Require().Nil(f.Close())
+
+	rbs, err = ioutil.ReadFile(name)
+	a.Require().Nil(err)
+	a.Require().Equal("01ab456789xyz", string(rbs))
+
+	f, err = os.OpenFile(name, os.O_RDWR|os.O_TRUNC, 0)
+	a.Require().Nilf(err, "open %s O_TRUNC failed.", name)
+	_, err = f.Write([]byte("new"))
+	a.Require().Nil(err, "write after truncate")
+	a.Require().Nil(f.Close())
+
+	rbs, err = ioutil.ReadFile(name)
+	a.Require().Nil(err)
+	a.Require().Equal("new", string(rbs))
+}
+
+// TestAppendWriteback appends across page boundaries under the default mount
+// options, where the kernel writeback cache writes dirty pages back at their
+// own offsets.
+func (a *AppSuite) TestAppendWriteback() {
+	name := a.absPath("append_wb")
+	head := bytes.Repeat([]byte("h"), 3000)
+	err := ioutil.WriteFile(name, head, 0644)
+	a.Require().Nilf(err, "write %s failed.", name)
+
+	want := append([]byte{}, head...)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	a.Require().Nilf(err, "open %s O_APPEND failed.", name)
+	for i := 0; i < 8; i++ {
+		chunk := bytes.Repeat([]byte{byte('a' + i)}, 1500)
+		_, err = f.Write(chunk)
+		a.Require().Nilf(err, "append %d", i)
+		want = append(want, chunk...)
+	}
+	a.Require().Nil(f.Sync())
+	a.Require().Nil(f.Close())
+
+	fi, err := os.Stat(name)
+	a.Require().Nilf(err, "stat %s failed.", name)
+	a.Require().Equal(int64(len(want)), fi.Size(), "file size")
+
+	rbs, err := ioutil.ReadFile(name)
+	a.Require().Nilf(err, "read %s failed.", name)
+	a.Require().True(bytes.Equal(want, rbs), "file data")
+}
+
+func (a *AppSuite) TestInodeUnique() {
+	inodes := map[uint64]string{}
+	for i := 0; i < 20; i++ {
+		name := a.absPath(fmt.Sprintf("ino_%d", i))
+		err := ioutil.WriteFile(name, nil, 0644)
+		a.Require().Nilf(err, "create %s failed.", name)
+
+		fi, err := os.Stat(name)
+		a.Require().Nilf(err, "stat %s failed.", name)
+		ino := fi.Sys().(*syscall.Stat_t).Ino
+		a.Require().NotContains(inodes, ino, "inode of %s is taken by %s", name, inodes[ino])
+		inodes[ino] = name
+	}
+}
+
+func (a *AppSuite) TestSetattr() {
+	name := a.absPath("sa_file")
+	err := ioutil.WriteFile(name, []byte("0123456789"), 0644)
+	a.Require().Nilf(err, "write %s failed.", name)
+
+	a.Require().Nil(os.Chmod(name, 0600), "chmod")
+	fi, err := os.Stat(name)
+	a.Require().Nil(err, "stat after chmod")
+	a.Require().Equal(os.FileMode(0600), fi.Mode().Perm())
+	a.Require().True(fi.Mode().IsRegular())
+	a.Require().Equal(int64(10), fi.Size(), "chmod keeps size")
+
+	a.Require().Nil(os.Truncate(name, 4), "shrink")
+	a.Require().Nil(os.Truncate(name, 8), "extend")
+	rbs, err := ioutil.ReadFile(name)
+	a.Require().Nil(err, "read after truncate")
+	a.Require().Equal("0123\x00\x00\x00\x00", string(rbs))
+}
+
+func (a *AppSuite) TestFsync() {
+	name := a.absPath("fs_file")
+	f, err := os.Create(name)
+	a.Require().Nilf(err, "create %s failed.", name)
+
+	_, err = f.Write([]byte("durable"))
+	a.Require().Nil(err, "write")
+	a.Require().Nil(f.Sync(), "fsync")
+	a.Require().Nil(f.Close())
+
+	d, err := os.Open(a.rootDir)
+	a.Require().Nil(err, "open root dir")
+	a.Require().Nil(d.Sync(), "fsync dir")
+	a.Require().Nil(d.Close())
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+func (a *AppSuite) TestSymlink() {
+	err := ioutil.WriteFile(a.absPath("sl_target"), []byte("target"), 0644)
+	a.Require().Nil(err, "write target")
+
+	_, stderr, err := a.doExec("ln", "-s", "sl_target", "sl_link")
+	a.Require().Nil(err, "ln -s failed, %s %s", err, stderr)
+
+	info, err := os.Lstat(a.absPath("sl_link"))
+	a.Require().Nil(err, "lstat link")
+	a.Require().True(info.Mode()&os.ModeSymlink != 0, "link mode %s", info.Mode())
+
+	target, err := os.Readlink(a.absPath("sl_link"))
+	a.Require().Nil(err, "readlink")
+	a.Require().Equal("sl_target", target)
+
+	rbs, err := ioutil.ReadFile(a.absPath("sl_link"))
+	a.Require().Nil(err, "read through link")
+	a.Require().Equal("target", string(rbs))
+
+	infos, err := ioutil.ReadDir(a.rootDir)
+	a.Require().Nil(err, "read dir")
+	for _, info := range infos {
+		if info.Name() == "sl_link" {
+			a.Require().True(info.Mode()&os.ModeSymlink != 0, "listed link mode %s", info.Mode())
+		}
+	}
+
+	a.Require().Nil(os.Remove(a.absPath("sl_link")), "remove link")
+	_, err = os.Stat(a.absPath("sl_target"))
+	a.Require().Nil(err, "target survives link removal")
+}
+
+func (a *AppSuite) TestHardLink() {
+	err := ioutil.WriteFile(a.absPath("hl_a"), []byte("shared"), 0644)
+	a.Require().Nil(err, "write hl_a")
+
+	_, stderr, err := a.doExec("ln", "hl_a", "hl_b")
+	a.Require().Nil(err, "ln failed, %s %s", err, stderr)
+
+	ia, err := a.getFileInfo("hl_a")
+	a.Require().Nil(err, "stat hl_a")
+	ib, err := a.getFileInfo("hl_b")
+	a.Require().Nil(err, "stat hl_b")
+	a.Require().True(os.SameFile(ia, ib), "links share an inode")
+	a.Require().Equal(uint64(2), uint64(ib.Sys().(*syscall.Stat_t).Nlink))
+
+	a.Require().Nil(os.Remove(a.absPath("hl_a")), "remove hl_a")
+	ib, err = a.getFileInfo("hl_b")
+	a.Require().Nil(err, "stat hl_b")
+	a.Require().Equal(uint64(1), uint64(ib.Sys().(*syscall.Stat_t).Nlink))
+
+	rbs, err := ioutil.ReadFile(a.absPath("hl_b"))
+	a.Require().Nil(err, "read hl_b")
+	a.Require().Equal("shared", string(rbs))
+}
+
+func (a *AppSuite) TestDirNlink() {
+	_, stderr, err := a.doExec("mkdir", "-p", "nl_dir/a", "nl_dir/b")
+	a.Require().Nil(err, "mkdir failed, %s %s", err, stderr)
+
+	info, err := a.getFileInfo("nl_dir")
+	a.Require().Nil(err, "stat nl_dir")
+	a.Require().Equal(uint64(4), uint64(info.Sys().(*syscall.Stat_t).Nlink))
+
+	a.Require().Nil(os.Remove(a.absPath("nl_dir/b")), "rmdir nl_dir/b")
+	info, err = a.getFileInfo("nl_dir")
+	a.Require().Nil(err, "stat nl_dir")
+	a.Require().Equal(uint64(3), uint64(info.Sys().(*syscall.Stat_t).Nlink))
+}
+
+func (a *AppSuite) TestUnlinkOpen() {
+	err := ioutil.WriteFile(a.absPath("ul_open"), []byte("still here"), 0644)
+	a.Require().Nil(err, "write file")
+
+	fd, err := os.OpenFile(a.absPath("ul_open"), os.O_RDWR, 0)
+	a.Require().Nil(err, "open file")
+	a.Require().Nil(os.Remove(a.absPath("ul_open")), "remove open file")
+	_, err = a.getFileInfo("ul_open")
+	a.Require().True(os.IsNotExist(err), "removed file still exists")
+
+	_, err = fd.WriteAt([]byte("!"), 10)
+	a.Require().Nil(err, "write unlinked file")
+	buf := make([]byte, 11)
+	n, err := fd.ReadAt(buf, 0)
+	a.Require().Nil(err, "read unlinked file")
+	a.Require().Equal("still here!", string(buf[:n]))
+
+	info, err := fd.Stat()
+	a.Require().Nil(err, "fstat unlinked file")
+	a.Require().Equal(uint64(0), uint64(info.Sys().(*syscall.Stat_t).Nlink))
+	a.Require().Nil(fd.Close(), "close unlinked file")
+}
+
+func (a *AppSuite) TestLinkUnlinked() {
+	name := a.absPath("ln_unlinked")
+	err := ioutil.WriteFile(name, []byte("gone"), 0644)
+	a.Require().Nil(err, "write file")
+
+	fd, err := os.Open(name)
+	a.Require().Nil(err, "open file")
+	defer fd.Close()
+	a.Require().Nil(os.Remove(name), "remove open file")
+
+	// ln -L links the file the descriptor refers to with AT_SYMLINK_FOLLOW.
+	proc := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), fd.Fd())
+	_, stderr, err := a.doExec("ln", "-L", proc, "ln_revived")
+	a.Require().NotNil(err, "link unlinked file")
+	a.Require().Contains(stderr, "No such file or directory")
+	_, err = a.getFileInfo("ln_revived")
+	a.Require().True(os.IsNotExist(err), "unlinked file linked again")
+}
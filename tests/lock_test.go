@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+func (a *AppSuite) TestFlock() {
+	err := ioutil.WriteFile(a.absPath("lk_file"), []byte("lock"), 0644)
+	a.Require().Nil(err, "write file")
+
+	f1, err := os.Open(a.absPath("lk_file"))
+	a.Require().Nil(err, "open f1")
+	defer f1.Close()
+	f2, err := os.Open(a.absPath("lk_file"))
+	a.Require().Nil(err, "open f2")
+	defer f2.Close()
+
+	a.Require().Nil(syscall.Flock(int(f1.Fd()), syscall.LOCK_EX), "lock f1")
+	err = syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	a.Require().Equal(syscall.EWOULDBLOCK, err)
+	err = syscall.Flock(int(f2.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	a.Require().Equal(syscall.EWOULDBLOCK, err)
+
+	done := make(chan error)
+	go func() {
+		done <- syscall.Flock(int(f2.Fd()), syscall.LOCK_SH)
+	}()
+	a.Require().Nil(syscall.Flock(int(f1.Fd()), syscall.LOCK_UN), "unlock f1")
+	a.Require().Nil(<-done, "wait for f2")
+
+	a.Require().Nil(syscall.Flock(int(f1.Fd()), syscall.LOCK_SH|syscall.LOCK_NB), "share with f2")
+	a.Require().Nil(syscall.Flock(int(f2.Fd()), syscall.LOCK_UN), "unlock f2")
+	a.Require().Nil(syscall.Flock(int(f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB), "upgrade f1")
+}
+
+func (a *AppSuite) TestPOSIXLock() {
+	err := ioutil.WriteFile(a.absPath("lk_posix"), []byte("0123456789"), 0644)
+	a.Require().Nil(err, "write file")
+	f, err := os.OpenFile(a.absPath("lk_posix"), os.O_RDWR, 0)
+	a.Require().Nil(err, "open file")
+	defer f.Close()
+
+	lk := &syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 5}
+	a.Require().Nil(syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, lk), "lock range")
+
+	query := &syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 10}
+	a.Require().Nil(syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, query), "query range")
+	a.Require().Equal(int16(syscall.F_UNLCK), query.Type, "own locks do not conflict")
+
+	lk.Type = syscall.F_UNLCK
+	a.Require().Nil(syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, lk), "unlock range")
+}
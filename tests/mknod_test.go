@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"os"
+	"syscall"
+)
+
+func (a *AppSuite) TestMknod() {
+	_, stderr, err := a.doExec("mkfifo", "mk_fifo")
+	a.Require().Nil(err, "mkfifo failed, %s %s", err, stderr)
+	err = syscall.Mknod(a.absPath("mk_sock"), syscall.S_IFSOCK|0644, 0)
+	a.Require().Nil(err, "mknod socket")
+
+	info, err := os.Lstat(a.absPath("mk_fifo"))
+	a.Require().Nil(err, "lstat fifo")
+	a.Require().True(info.Mode()&os.ModeNamedPipe != 0, "fifo mode %s", info.Mode())
+	info, err = os.Lstat(a.absPath("mk_sock"))
+	a.Require().Nil(err, "lstat socket")
+	a.Require().True(info.Mode()&os.ModeSocket != 0, "socket mode %s", info.Mode())
+
+	ents, err := a.readDirents(a.rootDir)
+	a.Require().Nil(err, "read dirents")
+	a.Require().Equal(uint8(syscall.DT_FIFO), ents["mk_fifo"].typ)
+	a.Require().Equal(uint8(syscall.DT_SOCK), ents["mk_sock"].typ)
+
+	err = syscall.Mknod(a.absPath("mk_null"), syscall.S_IFCHR|0644, 1<<8|3)
+	a.Require().Equal(syscall.EPERM, err)
+}
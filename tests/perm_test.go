@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+func (a *AppSuite) TestSetgidInherit() {
+	a.Require().Nil(os.Mkdir(a.absPath("sgid"), 0755), "mkdir")
+	a.Require().Nil(os.Chown(a.absPath("sgid"), 0, 1234), "chown")
+	a.Require().Nil(os.Chmod(a.absPath("sgid"), 0755|os.ModeSetgid), "chmod g+s")
+
+	err := ioutil.WriteFile(a.absPath("sgid/f"), []byte("f"), 0644)
+	a.Require().Nil(err, "write file")
+	a.Require().Nil(os.Mkdir(a.absPath("sgid/sub"), 0755), "mkdir sub")
+
+	info, err := a.getFileInfo("sgid/f")
+	a.Require().Nil(err, "stat file")
+	a.Require().Equal(uint32(1234), info.Sys().(*syscall.Stat_t).Gid)
+
+	info, err = a.getFileInfo("sgid/sub")
+	a.Require().Nil(err, "stat sub")
+	a.Require().Equal(uint32(1234), info.Sys().(*syscall.Stat_t).Gid)
+	a.Require().True(info.Mode()&os.ModeSetgid != 0, "sub mode %s", info.Mode())
+}
+
+func (a *AppSuite) TestAccess() {
+	err := ioutil.WriteFile(a.absPath("acc_file"), []byte("f"), 0644)
+	a.Require().Nil(err, "write file")
+
+	a.Require().Nil(syscall.Access(a.absPath("acc_file"), 4|2), "read write access")
+	a.Require().Equal(syscall.EACCES, syscall.Access(a.absPath("acc_file"), 1))
+
+	a.Require().Nil(os.Chmod(a.absPath("acc_file"), 0744), "chmod u+x")
+	a.Require().Nil(syscall.Access(a.absPath("acc_file"), 1), "exec access")
+}
+
+func (a *AppSuite) TestXattrPerm() {
+	name := a.absPath("xp_file")
+	err := ioutil.WriteFile(name, []byte("x"), 0644)
+	a.Require().Nil(err, "write file")
+	a.Require().Nil(syscall.Setxattr(name, "user.tag", []byte("v"), 0), "setxattr user")
+	a.Require().Nil(syscall.Setxattr(name, "trusted.tag", []byte("v"), 0), "setxattr trusted")
+
+	buf := make([]byte, 64)
+	a.asUser(1234, 1234, func() {
+		_, err := syscall.Getxattr(name, "user.tag", buf)
+		a.Require().Nil(err, "getxattr user as other")
+		a.Require().Equal(syscall.EACCES, syscall.Setxattr(name, "user.tag", []byte("w"), 0))
+		a.Require().Equal(syscall.EACCES, syscall.Removexattr(name, "user.tag"))
+		a.Require().Equal(syscall.EPERM, syscall.Setxattr(name, "trusted.tag", []byte("w"), 0))
+		a.Require().Equal(syscall.EPERM, syscall.Setxattr(name, "security.tag", []byte("w"), 0))
+
+		n, err := syscall.Listxattr(name, buf)
+		a.Require().Nil(err, "listxattr as other")
+		a.Require().Equal("user.tag\x00", string(buf[:n]))
+	})
+
+	n, err := syscall.Getxattr(name, "user.tag", buf)
+	a.Require().Nil(err, "getxattr user")
+	a.Require().Equal("v", string(buf[:n]))
+}
+
+func (a *AppSuite) TestSupplementaryGroup() {
+	name := a.absPath("sg_file")
+	err := ioutil.WriteFile(name, []byte("sg"), 0640)
+	a.Require().Nil(err, "write file")
+	a.Require().Nil(os.Chown(name, 0, 4321), "chown")
+
+	out, stderr, err := a.doExec("setpriv", "--reuid=1234", "--regid=1234", "--groups=4321", "cat", name)
+	a.Require().Nil(err, "read as group member, %s", stderr)
+	a.Require().Equal("sg", out)
+
+	_, _, err = a.doExec("setpriv", "--reuid=1234", "--regid=1234", "--clear-groups", "cat", name)
+	a.Require().NotNil(err, "read as other")
+}
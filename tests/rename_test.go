@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func (a *AppSuite) TestRenameFile() {
+	_, stderr, err := a.doExec("mkdir", "-p", "mv_src", "mv_dst")
+	a.Require().Nil(err, "mkdir failed, %s %s", err, stderr)
+	err = ioutil.WriteFile(a.absPath("mv_src/f1"), []byte("f1"), 0644)
+	a.Require().Nil(err, "write f1")
+
+	_, stderr, err = a.doExec("mv", "mv_src/f1", "mv_src/f2")
+	a.Require().Nil(err, "mv in dir failed, %s %s", err, stderr)
+	_, err = a.getFileInfo("mv_src/f1")
+	a.Require().True(os.IsNotExist(err), "old name still exists")
+
+	_, stderr, err = a.doExec("mv", "mv_src/f2", "mv_dst/f3")
+	a.Require().Nil(err, "mv across dirs failed, %s %s", err, stderr)
+	rbs, err := ioutil.ReadFile(a.absPath("mv_dst/f3"))
+	a.Require().Nil(err, "read moved file")
+	a.Require().Equal("f1", string(rbs))
+
+	err = ioutil.WriteFile(a.absPath("mv_dst/f4"), []byte("f4"), 0644)
+	a.Require().Nil(err, "write f4")
+	err = os.Rename(a.absPath("mv_dst/f4"), a.absPath("mv_dst/f3"))
+	a.Require().Nil(err, "rename over existing file")
+	rbs, err = ioutil.ReadFile(a.absPath("mv_dst/f3"))
+	a.Require().Nil(err, "read replaced file")
+	a.Require().Equal("f4", string(rbs))
+
+	infos, err := ioutil.ReadDir(a.absPath("mv_dst"))
+	a.Require().Nil(err, "read dir")
+	a.Require().Len(infos, 1)
+}
+
+func (a *AppSuite) TestRenameDir() {
+	_, stderr, err := a.doExec("mkdir", "-p", "mvd_src/sub/deep", "mvd_dst", "mvd_full/x")
+	a.Require().Nil(err, "mkdir failed, %s %s", err, stderr)
+	err = ioutil.WriteFile(a.absPath("mvd_src/sub/deep/f"), []byte("deep"), 0644)
+	a.Require().Nil(err, "write deep file")
+
+	err = os.Rename(a.absPath("mvd_src/sub"), a.absPath("mvd_dst/moved"))
+	a.Require().Nil(err, "rename dir")
+	rbs, err := ioutil.ReadFile(a.absPath("mvd_dst/moved/deep/f"))
+	a.Require().Nil(err, "read file below moved dir")
+	a.Require().Equal("deep", string(rbs))
+
+	err = os.Rename(a.absPath("mvd_dst/moved"), a.absPath("mvd_full"))
+	a.Require().NotNil(err, "rename over non-empty dir")
+
+	err = os.Rename(a.absPath("mvd_dst/moved/deep/f"), a.absPath("mvd_full"))
+	a.Require().NotNil(err, "rename file over dir")
+}
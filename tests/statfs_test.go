@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+func (a *AppSuite) TestStatfs() {
+	var before, after syscall.Statfs_t
+	a.Require().Nil(syscall.Statfs(a.rootDir, &before), "statfs")
+	a.Require().NotZero(before.Blocks, "blocks")
+	a.Require().NotZero(before.Bavail, "available blocks")
+	a.Require().NotZero(before.Ffree, "free inodes")
+
+	name := a.absPath("sf_file")
+	err := ioutil.WriteFile(name, make([]byte, 1<<20), 0644)
+	a.Require().Nil(err, "write sf_file")
+
+	a.Require().Nil(syscall.Statfs(a.rootDir, &after), "statfs")
+	a.Require().Equal(before.Bfree-uint64(1<<20)/uint64(after.Bsize), after.Bfree, "free blocks after write")
+	a.Require().Equal(before.Ffree-1, after.Ffree, "free inodes after create")
+
+	a.Require().Nil(os.Remove(name), "remove sf_file")
+	a.Require().Nil(syscall.Statfs(a.rootDir, &after), "statfs")
+	a.Require().Equal(before.Bfree, after.Bfree, "free blocks after remove")
+	a.Require().Equal(before.Ffree, after.Ffree, "free inodes after remove")
+}
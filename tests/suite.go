@@ -2,9 +2,12 @@ package tests
 
 import (
 	"bytes"
+	"encoding/binary"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"syscall"
 
 	"github.com/ckeyer/tarofs/pkgs/fs"
 	"github.com/stretchr/testify/suite"
@@ -35,3 +38,57 @@ func (a AppSuite) getFileInfo(name string) (os.FileInfo, error) {
 func (a AppSuite) absPath(name string) string {
 	return filepath.Join(a.rootDir, name)
 }
+
+// asUser runs fn with the file system ids of uid and gid, they only apply
+// to the locked thread of the caller.
+func (a AppSuite) asUser(uid, gid int, fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	syscall.Setfsgid(gid)
+	syscall.Setfsuid(uid)
+	defer syscall.Setfsgid(0)
+	defer syscall.Setfsuid(0)
+	fn()
+}
+
+// linuxDirent is an entry returned by getdents64.
+type linuxDirent struct {
+	ino uint64
+	typ uint8
+}
+
+// readDirents returns the entries of dir by name, "." and ".." included.
+func (a AppSuite) readDirents(dir string) (map[string]linuxDirent, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return a.readDirentsOf(d)
+}
+
+// readDirentsOf reads the entries of the open directory d by name.
+func (a AppSuite) readDirentsOf(d *os.File) (map[string]linuxDirent, error) {
+	ents := map[string]linuxDirent{}
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := syscall.ReadDirent(int(d.Fd()), buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return ents, nil
+		}
+		// linux_dirent64: ino u64, off s64, reclen u16, type u8, name.
+		for off := 0; off < n; {
+			reclen := int(binary.LittleEndian.Uint16(buf[off+16:]))
+			name := buf[off+19 : off+reclen]
+			ents[string(name[:bytes.IndexByte(name, 0)])] = linuxDirent{
+				ino: binary.LittleEndian.Uint64(buf[off:]),
+				typ: buf[off+18],
+			}
+			off += reclen
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+// utimensat(2) special nanosecond values.
+const (
+	utimeNow  = 1<<30 - 1
+	utimeOmit = 1<<30 - 2
+)
+
+func (a *AppSuite) TestTimestamps() {
+	err := ioutil.WriteFile(a.absPath("tm_file"), []byte("t"), 0644)
+	a.Require().Nil(err, "write file")
+
+	_, stderr, err := a.doExec("touch", "-d", "2001-02-03 04:05:06", "tm_file")
+	a.Require().Nil(err, "touch -d failed, %s %s", err, stderr)
+	info, err := a.getFileInfo("tm_file")
+	a.Require().Nil(err, "stat file")
+	want := time.Date(2001, 2, 3, 4, 5, 6, 0, time.Local)
+	a.Require().True(info.ModTime().Equal(want), "mtime %s", info.ModTime())
+
+	// keep the mtime and set the atime to now.
+	ts := []syscall.Timespec{{Nsec: utimeNow}, {Nsec: utimeOmit}}
+	a.Require().Nil(syscall.UtimesNano(a.absPath("tm_file"), ts), "utimensat")
+	info, err = a.getFileInfo("tm_file")
+	a.Require().Nil(err, "stat file")
+	st := info.Sys().(*syscall.Stat_t)
+	a.Require().True(info.ModTime().Equal(want), "mtime %s", info.ModTime())
+	a.Require().True(time.Unix(st.Atim.Unix()).After(want), "atime")
+
+	time.Sleep(10 * time.Millisecond)
+	f, err := os.OpenFile(a.absPath("tm_file"), os.O_WRONLY, 0)
+	a.Require().Nil(err, "open file")
+	_, err = f.Write([]byte("x"))
+	a.Require().Nil(err, "write")
+	a.Require().Nil(f.Close(), "close")
+	info, err = a.getFileInfo("tm_file")
+	a.Require().Nil(err, "stat file")
+	a.Require().True(info.ModTime().After(want), "write updates mtime")
+
+	a.Require().Nil(os.Mkdir(a.absPath("tm_dir"), 0755), "mkdir")
+	before, err := a.getFileInfo("tm_dir")
+	a.Require().Nil(err, "stat dir")
+	time.Sleep(10 * time.Millisecond)
+	a.Require().Nil(ioutil.WriteFile(a.absPath("tm_dir/f"), nil, 0644), "create in dir")
+	after, err := a.getFileInfo("tm_dir")
+	a.Require().Nil(err, "stat dir")
+	a.Require().True(after.ModTime().After(before.ModTime()), "create updates dir mtime")
+}
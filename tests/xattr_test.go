@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"io/ioutil"
+	"syscall"
+)
+
+func (a *AppSuite) TestXattr() {
+	name := a.absPath("xa_file")
+	err := ioutil.WriteFile(name, []byte("x"), 0644)
+	a.Require().Nil(err, "write xa_file")
+
+	err = syscall.Setxattr(name, "user.tag", []byte("v1"), 0)
+	a.Require().Nil(err, "setxattr")
+
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(name, "user.tag", buf)
+	a.Require().Nil(err, "getxattr")
+	a.Require().Equal("v1", string(buf[:n]))
+
+	err = syscall.Setxattr(name, "user.tag", []byte("v2"), 0x1)
+	a.Require().Equal(syscall.EEXIST, err, "XATTR_CREATE on existing attribute")
+	err = syscall.Setxattr(name, "user.none", []byte("v"), 0x2)
+	a.Require().Equal(syscall.ENODATA, err, "XATTR_REPLACE on missing attribute")
+
+	n, err = syscall.Listxattr(name, buf)
+	a.Require().Nil(err, "listxattr")
+	a.Require().Equal("user.tag\x00", string(buf[:n]))
+
+	err = syscall.Removexattr(name, "user.tag")
+	a.Require().Nil(err, "removexattr")
+	_, err = syscall.Getxattr(name, "user.tag", buf)
+	a.Require().Equal(syscall.ENODATA, err, "getxattr after remove")
+}